@@ -0,0 +1,109 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/micro/cli/v2"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/crypto"
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+	proxyHTTP "github.com/owncloud/ocis-proxy/pkg/server/http"
+	"github.com/spf13/viper"
+)
+
+// Config is the entrypoint for the config command.
+func Config(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Inspect the configuration",
+		Subcommands: []*cli.Command{
+			ConfigValidate(cfg),
+			ConfigDump(cfg),
+		},
+	}
+}
+
+// ConfigValidate is the entrypoint for the config validate command.
+func ConfigValidate(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "Validate the configuration and report all problems",
+		Before: func(c *cli.Context) error {
+			return ParseConfig(c, cfg)
+		},
+		Action: func(c *cli.Context) error {
+			err := validateConfig(cfg)
+
+			var errs config.ValidationErrors
+			switch {
+			case err == nil:
+				fmt.Fprintln(os.Stdout, "configuration is valid")
+				return nil
+			case errors.As(err, &errs):
+				for _, e := range errs {
+					fmt.Fprintln(os.Stderr, e.Error())
+				}
+				return cli.Exit(fmt.Sprintf("configuration has %d problem(s)", len(errs)), 1)
+			default:
+				return err
+			}
+		},
+	}
+}
+
+// validateConfig checks the loaded configuration, the keys of the configuration file and the policy-selector. All
+// problems are returned as config.ValidationErrors.
+func validateConfig(cfg *config.Config) error {
+	var errs config.ValidationErrors
+
+	unknown, err := config.UnknownKeys(viper.AllSettings())
+	if err != nil {
+		return err
+	}
+	for _, key := range unknown {
+		errs = append(errs, config.ValidationError{Path: key, Message: "unknown key"})
+	}
+
+	var cfgErrs config.ValidationErrors
+	if err := cfg.Validate(); errors.As(err, &cfgErrs) {
+		errs = append(errs, cfgErrs...)
+	}
+
+	if cfg.PolicySelector != nil && !hasErrorsAt(errs, "policy_selector") {
+		// the selectors validate their rules, operators and expressions when they are created
+		if _, err := policy.LoadSelector(cfg.PolicySelector); err != nil {
+			errs = append(errs, config.ValidationError{Path: "policy_selector", Message: err.Error()})
+		}
+	}
+
+	if _, err := crypto.TLSVersion(cfg.HTTP.TLSMinVersion); err != nil {
+		errs = append(errs, config.ValidationError{Path: "http.tls_min_version", Message: err.Error()})
+	}
+	if _, err := crypto.CipherSuites(cfg.HTTP.TLSCipherSuites); err != nil {
+		errs = append(errs, config.ValidationError{Path: "http.tls_cipher_suites", Message: err.Error()})
+	}
+
+	if cfg.HTTP.HTTP3 && !proxyHTTP.HTTP3Supported {
+		errs = append(errs, config.ValidationError{
+			Path:    "http.http3",
+			Message: "the proxy was built without HTTP/3 support, build it with -tags http3",
+		})
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func hasErrorsAt(errs config.ValidationErrors, prefix string) bool {
+	for _, e := range errs {
+		if strings.HasPrefix(e.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/micro/cli/v2"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/flagset"
+	"github.com/owncloud/ocis-proxy/pkg/proxy"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// Sources of configuration values.
+const (
+	// SourceDefault is a built-in default or the zero value
+	SourceDefault = "default"
+	// SourceFlag is a command line flag
+	SourceFlag = "flag"
+	// SourceEnv is a PROXY_* environment variable
+	SourceEnv = "env"
+	// SourceFile is the configuration file
+	SourceFile = "file"
+	// SourceRuntime is a value set by the proxy when it starts, e.g. the default policies
+	SourceRuntime = "runtime"
+)
+
+// redacted are the configuration keys whose values are never shown.
+var redacted = map[string]bool{
+	"tokenmanager.jwtsecret": true,
+	"debug.token":            true,
+}
+
+// ConfigDump is the entrypoint for the config dump command.
+func ConfigDump(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "dump",
+		Usage: "Print the effective configuration and the source of each value",
+		Flags: append(
+			flagset.ServerWithConfig(cfg),
+			&cli.StringFlag{
+				Name:  "output",
+				Value: "yaml",
+				Usage: "Output format, json or yaml",
+			},
+		),
+		Before: func(c *cli.Context) error {
+			applyServerFlags(c, cfg)
+			return ParseConfig(c, cfg)
+		},
+		Action: func(c *cli.Context) error {
+			// the proxy fills in the built-in defaults, e.g. the policies
+			proxy.NewMultiHostReverseProxy(
+				proxy.Logger(NewLogger(cfg)),
+				proxy.Config(cfg),
+			)
+
+			dump := dumpConfig(c, cfg)
+
+			var out []byte
+			var err error
+			switch c.String("output") {
+			case "json":
+				out, err = json.MarshalIndent(dump, "", "  ")
+				out = append(out, '\n')
+			case "yaml":
+				out, err = yaml.Marshal(dump)
+			default:
+				return fmt.Errorf("unknown output format %q", c.String("output"))
+			}
+			if err != nil {
+				return err
+			}
+
+			_, err = os.Stdout.Write(out)
+			return err
+		},
+	}
+}
+
+// configDump is the effective configuration, using the keys of the configuration file, and the source of each value.
+type configDump struct {
+	Config  map[string]interface{} `json:"config" yaml:"config"`
+	Sources map[string]string      `json:"sources" yaml:"sources"`
+}
+
+// dumpConfig returns the effective configuration with secrets redacted. The flags of the command in c are used to
+// tell flags, environment variables and defaults apart.
+func dumpConfig(c *cli.Context, cfg *config.Config) configDump {
+	d := &dumper{
+		flags:    flagDestinations(c, cfg),
+		settings: viper.AllSettings(),
+		sources:  map[string]string{},
+	}
+
+	m, _ := d.walk(reflect.ValueOf(cfg).Elem(), "").(map[string]interface{})
+	return configDump{Config: m, Sources: d.sources}
+}
+
+type dumper struct {
+	flags    map[interface{}]cli.Flag
+	settings map[string]interface{}
+	sources  map[string]string
+}
+
+// walk converts v to maps, lists and values and records the source of each value.
+func (d *dumper) walk(v reflect.Value, path string) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return d.walk(v.Elem(), path)
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		d.walkStruct(v, path, m)
+		return m
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			d.sources[path] = d.source(v, path)
+			return v.Interface()
+		}
+		l := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			l = append(l, d.walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i)))
+		}
+		return l
+	default:
+		d.sources[path] = d.source(v, path)
+		if redacted[path] && !v.IsZero() {
+			return "REDACTED"
+		}
+		if d, ok := v.Interface().(time.Duration); ok {
+			return d.String()
+		}
+		return v.Interface()
+	}
+}
+
+func (d *dumper) walkStruct(v reflect.Value, path string, m map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("mapstructure")
+		if tag == ",squash" {
+			d.walkStruct(v.Field(i), path, m)
+			continue
+		}
+
+		key := tag
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		if path != "" {
+			key = path + "." + key
+		}
+
+		if value := d.walk(v.Field(i), key); value != nil {
+			m[key[strings.LastIndex(key, ".")+1:]] = value
+		}
+	}
+}
+
+// source tells where the value at path came from. Values of the configuration file can be overridden by environment
+// variables, values of flags by the configuration file.
+func (d *dumper) source(v reflect.Value, path string) string {
+	fileKey := path
+	if i := strings.Index(fileKey, "["); i >= 0 {
+		fileKey = fileKey[:i]
+	}
+	if inSettings(d.settings, fileKey) {
+		if _, ok := os.LookupEnv("PROXY_" + strings.ToUpper(strings.ReplaceAll(fileKey, ".", "_"))); ok {
+			return SourceEnv
+		}
+		return SourceFile
+	}
+
+	if v.CanAddr() {
+		if f, ok := d.flags[v.Addr().Interface()]; ok {
+			switch {
+			case onCommandLine(f):
+				return SourceFlag
+			case envSet(f):
+				return SourceEnv
+			default:
+				return SourceDefault
+			}
+		}
+	}
+
+	if v.IsZero() {
+		return SourceDefault
+	}
+	return SourceRuntime
+}
+
+// inSettings reports whether the dotted key is part of the settings read from the configuration file.
+func inSettings(settings map[string]interface{}, key string) bool {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		value, ok := settings[part]
+		if !ok {
+			return false
+		}
+		if i == len(parts)-1 {
+			return true
+		}
+		if settings, ok = value.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+// flagDestinations maps the configuration values to the flags which set them.
+func flagDestinations(c *cli.Context, cfg *config.Config) map[interface{}]cli.Flag {
+	flags := map[interface{}]cli.Flag{}
+	for _, ctx := range c.Lineage() {
+		if ctx.App != nil {
+			addFlagDestinations(flags, ctx.App.Flags)
+		}
+		if ctx.Command != nil {
+			addFlagDestinations(flags, ctx.Command.Flags)
+		}
+	}
+
+	// the string slice flags are copied to the configuration by applyServerFlags
+	for _, f := range c.Command.Flags {
+		switch f.Names()[0] {
+		case "presignedurl-allow-method":
+			flags[&cfg.PreSignedURL.AllowedHTTPMethods] = f
+		case "access-log-exclude":
+			flags[&cfg.AccessLog.Exclude] = f
+		case "acme-domain":
+			flags[&cfg.HTTP.ACME.Domains] = f
+		case "tls-cipher-suite":
+			flags[&cfg.HTTP.TLSCipherSuites] = f
+		case "trusted-proxy":
+			flags[&cfg.TrustedProxies] = f
+		case "https-redirect-host":
+			flags[&cfg.HTTPSRedirect.Hosts] = f
+		}
+	}
+
+	return flags
+}
+
+func addFlagDestinations(flags map[interface{}]cli.Flag, fs []cli.Flag) {
+	for _, f := range fs {
+		switch f := f.(type) {
+		case *cli.StringFlag:
+			if f.Destination != nil {
+				flags[f.Destination] = f
+			}
+		case *cli.BoolFlag:
+			if f.Destination != nil {
+				flags[f.Destination] = f
+			}
+		case *cli.IntFlag:
+			if f.Destination != nil {
+				flags[f.Destination] = f
+			}
+		case *cli.DurationFlag:
+			if f.Destination != nil {
+				flags[f.Destination] = f
+			}
+		}
+	}
+}
+
+// onCommandLine reports whether a flag has been passed on the command line. Flags take precedence over their
+// environment variables.
+func onCommandLine(f cli.Flag) bool {
+	for _, arg := range os.Args[1:] {
+		if arg == "--" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		arg = strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		for _, name := range f.Names() {
+			if arg == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// envSet reports whether one of the environment variables of a flag is set.
+func envSet(f cli.Flag) bool {
+	var envVars []string
+	switch f := f.(type) {
+	case *cli.StringFlag:
+		envVars = f.EnvVars
+	case *cli.BoolFlag:
+		envVars = f.EnvVars
+	case *cli.IntFlag:
+		envVars = f.EnvVars
+	case *cli.DurationFlag:
+		envVars = f.EnvVars
+	case *cli.StringSliceFlag:
+		envVars = f.EnvVars
+	}
+
+	for _, e := range envVars {
+		if _, ok := os.LookupEnv(e); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/micro/cli/v2"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/spf13/viper"
+)
+
+func TestDumpConfig(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("http", map[string]interface{}{"addr": ":9200"})
+
+	cfg := config.New()
+	cfg.HTTP.Addr = ":9200"
+	cfg.Debug.Token = "debug-secret"
+	cfg.TokenManager.JWTSecret = "jwt-secret"
+	cfg.Policies = []config.Policy{
+		{Name: "reva", Routes: []config.Route{{Endpoint: "/", Backend: "http://localhost:9140"}}},
+	}
+
+	c := cli.NewContext(&cli.App{}, flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	dump := dumpConfig(c, cfg)
+
+	if got := dump.Config["tokenmanager"].(map[string]interface{})["jwtsecret"]; got != "REDACTED" {
+		t.Errorf("jwt secret is not redacted: %v", got)
+	}
+	if got := dump.Config["debug"].(map[string]interface{})["token"]; got != "REDACTED" {
+		t.Errorf("debug token is not redacted: %v", got)
+	}
+
+	route := dump.Config["policies"].([]interface{})[0].(map[string]interface{})["routes"].([]interface{})[0].(map[string]interface{})
+	if route["endpoint"] != "/" || route["backend"] != "http://localhost:9140" {
+		t.Errorf("Expected the route / to http://localhost:9140 got %v", route)
+	}
+
+	sources := map[string]string{
+		"http.addr":                     SourceFile,
+		"http.root":                     SourceDefault,
+		"policies[0].routes[0].backend": SourceRuntime,
+		"tokenmanager.jwtsecret":        SourceRuntime,
+	}
+	for path, want := range sources {
+		if got := dump.Sources[path]; got != want {
+			t.Errorf("source of %s = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"time"
+
+	"github.com/micro/cli/v2"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/crypto"
+)
+
+// GenCert is the entrypoint for the gencert command.
+func GenCert(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "gencert",
+		Usage: "Generate a TLS certificate and key, optionally signed by a local CA",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "key-type",
+				Value: crypto.DefaultKeyType,
+				Usage: "Type of the generated keys, one of rsa, ecdsa or ed25519",
+			},
+			&cli.StringSliceFlag{
+				Name:  "host",
+				Value: cli.NewStringSlice("localhost", "127.0.0.1"),
+				Usage: "--host cloud.example.com [--host 10.0.0.1], hostnames and IP addresses of the certificate",
+			},
+			&cli.StringFlag{
+				Name:  "out-dir",
+				Value: ".",
+				Usage: "Directory to write server.crt and server.key to",
+			},
+			&cli.BoolFlag{
+				Name:  "ca",
+				Usage: "Sign the certificate with the CA in ca.crt and ca.key of the output directory, the CA is created if it does not exist",
+			},
+			&cli.DurationFlag{
+				Name:  "valid-for",
+				Value: 365 * 24 * time.Hour,
+				Usage: "How long the certificate is valid",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			logger := NewLogger(cfg)
+
+			err := crypto.GenCert(
+				logger,
+				crypto.KeyType(c.String("key-type")),
+				crypto.Hosts(c.StringSlice("host")...),
+				crypto.OutDir(c.String("out-dir")),
+				crypto.CA(c.Bool("ca")),
+				crypto.ValidFor(c.Duration("valid-for")),
+			)
+			if err != nil {
+				logger.Error().Err(err).Msg("Could not generate the certificate")
+				return err
+			}
+			return nil
+		},
+	}
+}
@@ -38,6 +38,9 @@ func Execute() error {
 		Commands: []*cli.Command{
 			Server(cfg),
 			Health(cfg),
+			Routes(cfg),
+			Config(cfg),
+			GenCert(cfg),
 		},
 	}
 
@@ -0,0 +1,154 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/micro/cli/v2"
+	"github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/proxy"
+)
+
+// Routes is the entrypoint for the routes command.
+func Routes(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:      "routes",
+		Usage:     "Print the route table or explain how a request is routed",
+		ArgsUsage: "[url]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "method",
+				Value: http.MethodGet,
+				Usage: "Method of the request to explain",
+			},
+			&cli.StringSliceFlag{
+				Name:  "header",
+				Usage: "Header of the request to explain, e.g. \"X-Rollout: reva\"",
+			},
+			&cli.StringSliceFlag{
+				Name:  "claim",
+				Usage: "Simulated oidc claim of the user, e.g. \"preferred_username=einstein\", repeat for lists",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			return ParseConfig(c, cfg)
+		},
+		Action: func(c *cli.Context) error {
+			logger := NewLogger(cfg)
+			rp := proxy.NewMultiHostReverseProxy(
+				proxy.Logger(logger),
+				proxy.Config(cfg),
+			)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			defer w.Flush()
+
+			if c.NArg() == 0 {
+				fmt.Fprintln(w, "POLICY\tTYPE\tENDPOINT\tBACKEND\tAPACHE-VHOST")
+				for _, rt := range rp.Routes() {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", rt.Policy, rt.Type, rt.Endpoint, rt.Backend, rt.ApacheVHost)
+				}
+				return nil
+			}
+
+			r, err := explainRequest(c.Args().First(), c.String("method"), c.StringSlice("header"), c.StringSlice("claim"))
+			if err != nil {
+				return err
+			}
+
+			explanation, err := rp.Explain(r)
+			fmt.Fprintf(w, "policy:\t%s\n", explanation.Policy)
+			if err != nil {
+				fmt.Fprintf(w, "error:\t%s\n", err)
+				return nil
+			}
+			fmt.Fprintf(w, "route type:\t%s\n", explanation.RouteType)
+			fmt.Fprintf(w, "endpoint:\t%s\n", explanation.Endpoint)
+			fmt.Fprintf(w, "backend:\t%s\n", explanation.Backend)
+			fmt.Fprintf(w, "upstream:\t%s\n", explanation.Upstream)
+			fmt.Fprintf(w, "host:\t%s\n", explanation.Host)
+			return nil
+		},
+	}
+}
+
+// explainRequest builds the request to explain. Claims are only added when at least one is given.
+func explainRequest(target, method string, headers, claims []string) (*http.Request, error) {
+	r := httptest.NewRequest(method, target, nil)
+	for _, h := range headers {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		r.Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	if len(claims) == 0 {
+		return r, nil
+	}
+
+	c, err := parseClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.WithContext(oidc.NewContext(context.Background(), c)), nil
+}
+
+// parseClaims converts name=value pairs to claims, using the json names and types of oidc.StandardClaims.
+func parseClaims(pairs []string) (*oidc.StandardClaims, error) {
+	types := map[string]reflect.Type{}
+	t := reflect.TypeOf(oidc.StandardClaims{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		types[name] = t.Field(i).Type
+	}
+
+	values := map[string]interface{}{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid claim %q, expected \"name=value\"", pair)
+		}
+		name, value := parts[0], parts[1]
+
+		switch kind := types[name]; {
+		case kind == nil:
+			return nil, fmt.Errorf("unknown claim %q", name)
+		case kind.Kind() == reflect.Slice:
+			list, _ := values[name].([]string)
+			values[name] = append(list, value)
+		case kind.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid claim %q: %w", pair, err)
+			}
+			values[name] = b
+		case kind.Kind() == reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid claim %q: %w", pair, err)
+			}
+			values[name] = n
+		default:
+			values[name] = value
+		}
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &oidc.StandardClaims{}
+	return claims, json.Unmarshal(b, claims)
+}
@@ -3,6 +3,9 @@ package command
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,6 +17,7 @@ import (
 	"contrib.go.opencensus.io/exporter/ocagent"
 	"contrib.go.opencensus.io/exporter/zipkin"
 	"github.com/coreos/go-oidc"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	"github.com/justinas/alice"
 	"github.com/micro/cli/v2"
 	mclient "github.com/micro/go-micro/v2/client"
@@ -24,18 +28,23 @@ import (
 	acc "github.com/owncloud/ocis-accounts/pkg/proto/v0"
 	"github.com/owncloud/ocis-pkg/v2/log"
 	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/crypto"
 	"github.com/owncloud/ocis-proxy/pkg/cs3"
 	"github.com/owncloud/ocis-proxy/pkg/flagset"
 	"github.com/owncloud/ocis-proxy/pkg/metrics"
 	"github.com/owncloud/ocis-proxy/pkg/middleware"
 	"github.com/owncloud/ocis-proxy/pkg/proxy"
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+	"github.com/owncloud/ocis-proxy/pkg/request"
 	"github.com/owncloud/ocis-proxy/pkg/server/debug"
 	proxyHTTP "github.com/owncloud/ocis-proxy/pkg/server/http"
 	settings "github.com/owncloud/ocis-settings/pkg/proto/v0"
 	storepb "github.com/owncloud/ocis-store/pkg/proto/v0"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
+	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/oauth2"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // Server is the entrypoint for the server command.
@@ -47,10 +56,7 @@ func Server(cfg *config.Config) *cli.Command {
 		Before: func(ctx *cli.Context) error {
 			l := NewLogger(cfg)
 			l.Debug().Str("tracing", strconv.FormatBool(cfg.Tracing.Enabled)).Msg("init: before")
-			if cfg.HTTP.Root != "/" {
-				cfg.HTTP.Root = strings.TrimSuffix(cfg.HTTP.Root, "/")
-			}
-			cfg.PreSignedURL.AllowedHTTPMethods = ctx.StringSlice("presignedurl-allow-method")
+			applyServerFlags(ctx, cfg)
 
 			// When running on single binary mode the before hook from the root command won't get called. We manually
 			// call this before hook from ocis command, so the configuration can be loaded.
@@ -60,6 +66,19 @@ func Server(cfg *config.Config) *cli.Command {
 			logger := NewLogger(cfg)
 			httpNamespace := c.String("http-namespace")
 
+			if err := validateConfig(cfg); err != nil {
+				var errs config.ValidationErrors
+				if !errors.As(err, &errs) {
+					logger.Error().Err(err).Msg("Could not validate configuration")
+					return err
+				}
+
+				for _, e := range errs {
+					logger.Error().Str("path", e.Path).Msg(e.Message)
+				}
+				return fmt.Errorf("invalid configuration: %d problem(s)", len(errs))
+			}
+
 			if cfg.Tracing.Enabled {
 				switch t := cfg.Tracing.Type; t {
 				case "agent":
@@ -155,9 +174,108 @@ func Server(cfg *config.Config) *cli.Command {
 			rp := proxy.NewMultiHostReverseProxy(
 				proxy.Logger(logger),
 				proxy.Config(cfg),
+				proxy.Metrics(metrics),
 			)
 
+			var acmeManager *autocert.Manager
+			if cfg.HTTP.TLS && cfg.HTTP.ACME.Enabled {
+				var err error
+				if acmeManager, err = crypto.NewACMEManager(cfg.HTTP.ACME); err != nil {
+					logger.Error().
+						Err(err).
+						Msg("Failed to initialize acme")
+
+					return err
+				}
+			}
+
+			if acmeManager != nil && cfg.HTTP.ACME.HTTPAddr != "" {
+				// answers HTTP-01 challenges and redirects all other requests to https
+				server := &http.Server{
+					Addr:    cfg.HTTP.ACME.HTTPAddr,
+					Handler: acmeManager.HTTPHandler(nil),
+				}
+
+				gr.Add(func() error {
+					return server.ListenAndServe()
+				}, func(_ error) {
+					ctx, timeout := context.WithTimeout(ctx, 5*time.Second)
+
+					defer timeout()
+					defer cancel()
+
+					if err := server.Shutdown(ctx); err != nil {
+						logger.Error().
+							Err(err).
+							Str("server", "acme").
+							Msg("Failed to shutdown server")
+					} else {
+						logger.Info().
+							Str("server", "acme").
+							Msg("Shutting down server")
+					}
+				})
+			}
+
+			svcs := newMiddlewareServices(logger, cfg)
+
+			// the certificates are loaded and watched once for all listeners
+			var tlsConfig *tls.Config
+			if usesTLS(cfg) {
+				tlsConfig = proxyHTTP.LoadTLSConfig(
+					proxyHTTP.Logger(logger),
+					proxyHTTP.Context(ctx),
+					proxyHTTP.Config(cfg),
+					proxyHTTP.ACMEManager(acmeManager),
+				)
+			}
+
 			{
+				middlewares := loadMiddlewares(ctx, logger, cfg, metrics, rp.PolicySelector, svcs, defaultListener(cfg))
+
+				if cfg.HTTP.HTTP3 {
+					server, err := proxyHTTP.HTTP3(
+						proxyHTTP.Handler(rp),
+						proxyHTTP.Logger(logger),
+						proxyHTTP.Context(ctx),
+						proxyHTTP.Config(cfg),
+						proxyHTTP.Middlewares(middlewares),
+						proxyHTTP.TLSConfig(tlsConfig),
+					)
+
+					if err != nil {
+						logger.Error().
+							Err(err).
+							Str("server", "http3").
+							Msg("Failed to initialize server")
+
+						return err
+					}
+
+					gr.Add(func() error {
+						logger.Info().
+							Str("server", "http3").
+							Str("addr", server.Addr()).
+							Msg("Starting server")
+
+						return server.ListenAndServe()
+					}, func(_ error) {
+						logger.Info().
+							Str("server", "http3").
+							Msg("Shutting down server")
+
+						if err := server.Close(); err != nil {
+							logger.Error().
+								Err(err).
+								Str("server", "http3").
+								Msg("Failed to shut down server")
+						}
+					})
+
+					// the TCP server tells the clients where to find HTTP/3
+					middlewares = middlewares.Append(server.AltSvc)
+				}
+
 				server, err := proxyHTTP.Server(
 					proxyHTTP.Handler(rp),
 					proxyHTTP.Logger(logger),
@@ -167,7 +285,9 @@ func Server(cfg *config.Config) *cli.Command {
 					proxyHTTP.Metrics(metrics),
 					proxyHTTP.Flags(flagset.RootWithConfig(config.New())),
 					proxyHTTP.Flags(flagset.ServerWithConfig(config.New())),
-					proxyHTTP.Middlewares(loadMiddlewares(ctx, logger, cfg)),
+					proxyHTTP.Middlewares(middlewares),
+					proxyHTTP.ACMEManager(acmeManager),
+					proxyHTTP.TLSConfig(tlsConfig),
 				)
 
 				if err != nil {
@@ -190,11 +310,61 @@ func Server(cfg *config.Config) *cli.Command {
 				})
 			}
 
+			for _, lc := range cfg.Listeners {
+				server, err := proxyHTTP.Listener(
+					proxyHTTP.Handler(rp),
+					proxyHTTP.Logger(logger),
+					proxyHTTP.Context(ctx),
+					proxyHTTP.Config(cfg),
+					proxyHTTP.Metrics(metrics),
+					proxyHTTP.Middlewares(loadMiddlewares(ctx, logger, cfg, metrics, rp.PolicySelector, svcs, lc)),
+					proxyHTTP.ACMEManager(acmeManager),
+					proxyHTTP.TLSConfig(tlsConfig),
+					proxyHTTP.ListenerConfig(lc),
+				)
+
+				if err != nil {
+					logger.Error().
+						Err(err).
+						Str("server", lc.Name).
+						Msg("Failed to initialize listener")
+
+					return err
+				}
+
+				name := lc.Name
+				gr.Add(func() error {
+					logger.Info().
+						Str("server", name).
+						Str("addr", server.Addr).
+						Msg("Starting listener")
+
+					return server.ListenAndServe()
+				}, func(_ error) {
+					ctx, timeout := context.WithTimeout(ctx, 5*time.Second)
+
+					defer timeout()
+					defer cancel()
+
+					if err := server.Shutdown(ctx); err != nil {
+						logger.Error().
+							Err(err).
+							Str("server", name).
+							Msg("Failed to shutdown listener")
+					} else {
+						logger.Info().
+							Str("server", name).
+							Msg("Shutting down listener")
+					}
+				})
+			}
+
 			{
 				server, err := debug.Server(
 					debug.Logger(logger),
 					debug.Context(ctx),
 					debug.Config(cfg),
+					debug.ConfigDump(dumpConfig(c, cfg)),
 				)
 
 				if err != nil {
@@ -247,42 +417,120 @@ func Server(cfg *config.Config) *cli.Command {
 	}
 }
 
-func loadMiddlewares(ctx context.Context, l log.Logger, cfg *config.Config) alice.Chain {
+// applyServerFlags applies the server flags which can not be bound to the configuration directly.
+func applyServerFlags(ctx *cli.Context, cfg *config.Config) {
+	if cfg.HTTP.Root != "/" {
+		cfg.HTTP.Root = strings.TrimSuffix(cfg.HTTP.Root, "/")
+	}
+	cfg.PreSignedURL.AllowedHTTPMethods = ctx.StringSlice("presignedurl-allow-method")
+	cfg.AccessLog.Exclude = ctx.StringSlice("access-log-exclude")
+	cfg.HTTP.ACME.Domains = ctx.StringSlice("acme-domain")
+	cfg.HTTP.TLSCipherSuites = ctx.StringSlice("tls-cipher-suite")
+	if ctx.IsSet("trusted-proxy") {
+		cfg.TrustedProxies = ctx.StringSlice("trusted-proxy")
+	}
+	if ctx.IsSet("https-redirect-host") {
+		cfg.HTTPSRedirect.Hosts = ctx.StringSlice("https-redirect-host")
+	}
+}
+
+// middlewareServices are shared by the middlewares of all listeners.
+type middlewareServices struct {
+	accessLog io.Writer
+	accounts  acc.AccountsService
+	roles     settings.RoleService
+	store     storepb.StoreService
+	gateway   gateway.GatewayAPIClient
+}
+
+// newMiddlewareServices creates the clients of the middlewares and the access log writer, which must not be opened
+// twice as the log file is rotated.
+func newMiddlewareServices(l log.Logger, cfg *config.Config) middlewareServices {
+	s := middlewareServices{
+		store: storepb.NewStoreService("com.owncloud.api.store", grpc.NewClient()),
+		// TODO this won't work with a registry other than mdns. Look into Micro's client initialization.
+		// https://github.com/owncloud/ocis-proxy/issues/38
+		accounts: acc.NewAccountsService(config.AccountsService, mclient.DefaultClient),
+		roles:    settings.NewRoleService("com.owncloud.api.settings", mclient.DefaultClient),
+	}
+
+	if cfg.AccessLog.Enabled {
+		s.accessLog = accessLogWriter(cfg.AccessLog)
+	}
+
+	// the connection will be established in a non blocking fashion
+	var err error
+	if s.gateway, err = cs3.GetGatewayServiceClient(cfg.Reva.Address); err != nil {
+		l.Error().Err(err).
+			Str("gateway", cfg.Reva.Address).
+			Msg("Failed to create reva gateway service client")
+	}
+
+	return s
+}
+
+// loadMiddlewares returns the middlewares of a listener. The optional middlewares are only used if they are enabled
+// for the listener and configured.
+func loadMiddlewares(ctx context.Context, l log.Logger, cfg *config.Config, m *metrics.Metrics, selector policy.Selector, svcs middlewareServices, listener config.Listener) alice.Chain {
+	enabled := map[string]bool{}
+	for _, name := range listener.Middlewares {
+		enabled[name] = true
+	}
 
 	psMW := middleware.PresignedURL(
 		middleware.Logger(l),
-		middleware.Store(storepb.NewStoreService("com.owncloud.api.store", grpc.NewClient())),
+		middleware.Store(svcs.store),
 		middleware.PreSignedURLConfig(cfg.PreSignedURL),
+		middleware.Metrics(m),
 	)
 
-	// TODO this won't work with a registry other than mdns. Look into Micro's client initialization.
-	// https://github.com/owncloud/ocis-proxy/issues/38
-	accounts := acc.NewAccountsService("com.owncloud.api.accounts", mclient.DefaultClient)
-	roles := settings.NewRoleService("com.owncloud.api.settings", mclient.DefaultClient)
-
 	uuidMW := middleware.AccountUUID(
 		middleware.Logger(l),
 		middleware.TokenManagerConfig(cfg.TokenManager),
-		middleware.AccountsClient(accounts),
-		middleware.SettingsRoleService(roles),
+		middleware.AccountsClient(svcs.accounts),
+		middleware.SettingsRoleService(svcs.roles),
+		middleware.NoProvisioningPolicies(policy.NotMigratedPolicies(cfg.PolicySelector)),
+		middleware.Metrics(m),
 	)
 
-	// the connection will be established in a non blocking fashion
-	sc, err := cs3.GetGatewayServiceClient(cfg.Reva.Address)
-	if err != nil {
-		l.Error().Err(err).
-			Str("gateway", cfg.Reva.Address).
-			Msg("Failed to create reva gateway service client")
-	}
-
 	chMW := middleware.CreateHome(
 		middleware.Logger(l),
-		middleware.RevaGatewayClient(sc),
-		middleware.AccountsClient(accounts),
+		middleware.RevaGatewayClient(svcs.gateway),
+		middleware.AccountsClient(svcs.accounts),
 		middleware.TokenManagerConfig(cfg.TokenManager),
 	)
 
-	if cfg.OIDC.Issuer != "" {
+	// the configuration has been validated already
+	trusted, err := request.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to parse the trusted proxies, forwarding headers are ignored")
+	}
+
+	chain := alice.New(middleware.RequestID, middleware.Forwarded(middleware.TrustedProxies(trusted)))
+
+	if cfg.Tracing.Enabled && enabled[config.MiddlewareTracing] {
+		chain = chain.Append(middleware.Tracing)
+	}
+
+	chain = chain.Append(middleware.Instrument(middleware.Metrics(m)))
+
+	if cfg.AccessLog.Enabled && enabled[config.MiddlewareAccessLog] {
+		l.Info().Str("format", cfg.AccessLog.Format).Str("output", cfg.AccessLog.Output).Msg("Loading AccessLog-Middleware")
+
+		chain = chain.Append(middleware.AccessLog(
+			middleware.Logger(l),
+			middleware.AccessLogConfig(cfg.AccessLog),
+			middleware.AccessLogWriter(svcs.accessLog),
+		))
+	}
+
+	if enabled[config.MiddlewareHTTPSRedirect] {
+		chain = chain.Append(middleware.RedirectToHTTPS(
+			middleware.HTTPSRedirectConfig(cfg.HTTPSRedirect),
+		))
+	}
+
+	if cfg.OIDC.Issuer != "" && enabled[config.MiddlewareOIDC] {
 		l.Info().Msg("Loading OIDC-Middleware")
 		l.Debug().Interface("oidc_config", cfg.OIDC).Msg("OIDC-Config")
 
@@ -310,10 +558,79 @@ func loadMiddlewares(ctx context.Context, l log.Logger, cfg *config.Config) alic
 			middleware.HTTPClient(oidcHTTPClient),
 			middleware.OIDCProviderFunc(provider),
 			middleware.OIDCIss(cfg.OIDC.Issuer),
+			middleware.Metrics(m),
 		)
 
-		return alice.New(middleware.RedirectToHTTPS, oidcMW, psMW, uuidMW, chMW)
+		chain = chain.Append(oidcMW)
+	}
+
+	if cfg.ClientCertAuth.Enabled && enabled[config.MiddlewareClientCert] {
+		l.Info().Msg("Loading ClientCertAuth-Middleware")
+
+		// after OIDC so a client certificate takes precedence on its paths
+		chain = chain.Append(middleware.ClientCertAuth(
+			middleware.Logger(l),
+			middleware.ClientCertAuthConfig(cfg.ClientCertAuth),
+			middleware.Metrics(m),
+		))
 	}
 
-	return alice.New(middleware.RedirectToHTTPS, psMW, uuidMW, chMW)
+	// select the policy after authentication but before accounts are provisioned
+	spMW := middleware.SelectPolicy(
+		middleware.Logger(l),
+		middleware.PolicySelector(selector),
+	)
+
+	if enabled[config.MiddlewarePresignedURL] {
+		chain = chain.Append(psMW)
+	}
+
+	chain = chain.Append(spMW, middleware.AllowPolicies(
+		middleware.Logger(l),
+		middleware.AllowedPolicies(listener.Policies),
+	), uuidMW)
+
+	if enabled[config.MiddlewareCreateHome] {
+		chain = chain.Append(chMW)
+	}
+
+	return chain
+}
+
+// defaultListener is the listener at HTTP.Addr, it uses all middlewares and policies.
+func defaultListener(cfg *config.Config) config.Listener {
+	return config.Listener{
+		Name:        "default",
+		Addr:        cfg.HTTP.Addr,
+		TLS:         cfg.HTTP.TLS,
+		H2C:         cfg.HTTP.H2C,
+		Middlewares: config.ListenerMiddlewares,
+	}
+}
+
+// usesTLS reports whether one of the listeners uses TLS.
+func usesTLS(cfg *config.Config) bool {
+	if cfg.HTTP.TLS {
+		return true
+	}
+	for _, l := range cfg.Listeners {
+		if l.TLS {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLogWriter returns the writer for the access log. Log files are rotated.
+func accessLogWriter(cfg config.AccessLog) io.Writer {
+	if cfg.Output == "" || cfg.Output == "stdout" {
+		return os.Stdout
+	}
+
+	return &lumberjack.Logger{
+		Filename:   cfg.Output,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+	}
 }
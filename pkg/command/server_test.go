@@ -0,0 +1,40 @@
+package command
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	"github.com/micro/cli/v2"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/flagset"
+)
+
+func TestApplyServerFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		exclude []string
+	}{
+		{args: nil, exclude: []string{"/healthz", "/status.php"}},
+		{args: []string{"--access-log-exclude", "/ping"}, exclude: []string{"/ping"}},
+	}
+
+	for _, tt := range tests {
+		cfg := config.New()
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		for _, f := range flagset.ServerWithConfig(cfg) {
+			if err := f.Apply(set); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if err := set.Parse(tt.args); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		applyServerFlags(cli.NewContext(&cli.App{}, set, nil), cfg)
+
+		if !reflect.DeepEqual(cfg.AccessLog.Exclude, tt.exclude) {
+			t.Errorf("with %v expected the excluded paths %v got %v", tt.args, tt.exclude, cfg.AccessLog.Exclude)
+		}
+	}
+}
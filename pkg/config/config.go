@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Log defines the available logging configuration.
 type Log struct {
 	Level  string
@@ -23,6 +25,98 @@ type HTTP struct {
 	TLSCert   string
 	TLSKey    string
 	TLS       bool
+	// TLSCertDir contains <name>.crt and <name>.key pairs, the certificate is chosen by the server name (SNI)
+	TLSCertDir string `mapstructure:"tls_cert_dir"`
+	// TLSReloadInterval is how often the certificate files are checked for changes
+	TLSReloadInterval time.Duration `mapstructure:"tls_reload_interval"`
+	// TLSMinVersion is one of "1.0", "1.1", "1.2" or "1.3"
+	TLSMinVersion string `mapstructure:"tls_min_version"`
+	// TLSCipherSuites are IANA names of the cipher suites for TLS 1.2 and lower, empty uses the Go defaults
+	TLSCipherSuites []string `mapstructure:"tls_cipher_suites"`
+	// HTTP2 offers HTTP/2 on TLS connections
+	HTTP2 bool
+	// H2C serves HTTP/2 without TLS, e.g. behind a load balancer which terminates TLS
+	H2C bool
+	// HTTP3 serves HTTP/3 (QUIC) on the UDP port of Addr and advertises it with Alt-Svc, needs the http3 build tag
+	HTTP3 bool
+	ACME  ACME
+}
+
+// Listener is an additional address the proxy serves on, with its own middlewares and policies. The listener at
+// HTTP.Addr uses all middlewares and policies.
+type Listener struct {
+	Name string
+	// Addr is host:port, or unix:/path/to/socket for a unix socket
+	Addr string
+	// TLS uses the certificates configured in HTTP
+	TLS bool
+	H2C bool
+	// Middlewares lists the optional middlewares used by the listener, see ListenerMiddlewares
+	Middlewares []string
+	// Policies lists the policies requests may be routed to, empty allows all policies
+	Policies []string
+}
+
+// Optional middlewares of a listener.
+const (
+	MiddlewareTracing       = "tracing"
+	MiddlewareAccessLog     = "access_log"
+	MiddlewareHTTPSRedirect = "https_redirect"
+	MiddlewareOIDC          = "oidc"
+	MiddlewareClientCert    = "client_cert"
+	MiddlewarePresignedURL  = "presigned_url"
+	MiddlewareCreateHome    = "create_home"
+)
+
+// ListenerMiddlewares lists the optional middlewares of a listener. Request IDs, metrics, the policy selection and
+// the account resolution are always used.
+var ListenerMiddlewares = []string{
+	MiddlewareTracing,
+	MiddlewareAccessLog,
+	MiddlewareHTTPSRedirect,
+	MiddlewareOIDC,
+	MiddlewareClientCert,
+	MiddlewarePresignedURL,
+	MiddlewareCreateHome,
+}
+
+// ACME defines the configuration of automatic certificates from an ACME certificate authority, e.g. Let's Encrypt.
+type ACME struct {
+	Enabled bool
+	// Domains the proxy requests certificates for, requests for other hosts get no certificate
+	Domains []string
+	Email   string
+	// DirectoryURL of the certificate authority, defaults to Let's Encrypt
+	DirectoryURL string `mapstructure:"directory_url"`
+	// CACert is a PEM file with the certificate of the ACME server, e.g. of a local test CA like Pebble
+	CACert string `mapstructure:"ca_cert"`
+	// CacheDir stores the account key and the certificates across restarts
+	CacheDir string `mapstructure:"cache_dir"`
+	// HTTPAddr answers HTTP-01 challenges and redirects everything else to https, empty only allows TLS-ALPN-01
+	HTTPAddr string `mapstructure:"http_addr"`
+	// RenewBefore is how long before expiry certificates are renewed, defaults to 30 days
+	RenewBefore time.Duration `mapstructure:"renew_before"`
+}
+
+// HTTPSRedirect defines the configuration of the https redirect middleware. Requests which reached a trusted proxy
+// over plain http are always redirected.
+type HTTPSRedirect struct {
+	// Plaintext also redirects plain http connections made directly to the proxy
+	Plaintext bool
+	// Hosts the redirects may point to, other hosts are redirected to the first one. Empty keeps the requested host.
+	Hosts []string
+	// Port of the redirect target, 0 and 443 are omitted
+	Port int
+	HSTS HSTS
+}
+
+// HSTS defines the Strict-Transport-Security header sent on https requests.
+type HSTS struct {
+	// MaxAge of the policy, 0 sends no header
+	MaxAge            time.Duration `mapstructure:"max_age"`
+	IncludeSubdomains bool          `mapstructure:"include_subdomains"`
+	// Preload requires a max age of at least one year and IncludeSubdomains
+	Preload bool
 }
 
 // Tracing defines the available tracing configuration.
@@ -34,6 +128,30 @@ type Tracing struct {
 	Service   string
 }
 
+// AccessLog defines the available access log configuration.
+type AccessLog struct {
+	Enabled bool
+	// Format is one of "json", "combined" or "template"
+	Format string
+	// Template is the text/template used by the "template" format
+	Template string
+	// Output is either "stdout" or the path of a log file which is rotated
+	Output     string
+	MaxSize    int `mapstructure:"max_size"`
+	MaxBackups int `mapstructure:"max_backups"`
+	MaxAge     int `mapstructure:"max_age"`
+	// Exclude contains path prefixes which are never logged, e.g. health checks
+	Exclude  []string
+	Sampling []AccessLogSampling
+}
+
+// AccessLogSampling logs only a fraction of the requests whose path starts with Prefix.
+type AccessLogSampling struct {
+	Prefix string
+	// Rate between 0 (log nothing) and 1 (log everything)
+	Rate float64
+}
+
 // Asset defines the available asset configuration.
 type Asset struct {
 	Path string
@@ -51,8 +169,67 @@ type Route struct {
 	Endpoint    string
 	Backend     string
 	ApacheVHost bool `mapstructure:"apache-vhost"`
+	// HTTP2 speaks HTTP/2 to an http backend (h2c). https backends always use HTTP/2 if they support it.
+	HTTP2 bool
+	// Forwarded selects the forwarding headers sent to the backend, one of ForwardedHeaders. Defaults to
+	// "x-forwarded".
+	Forwarded string
+	// ForwardedPrefix is sent as X-Forwarded-Prefix, e.g. the path the proxy serves the backend at
+	ForwardedPrefix string `mapstructure:"forwarded_prefix"`
+	// PreserveHost sends the host requested by the client, also behind trusted proxies
+	PreserveHost bool `mapstructure:"preserve_host"`
+	// RequestHeaders are applied in order to the request sent to the backend
+	RequestHeaders []HeaderRule `mapstructure:"request_headers"`
+	// ResponseHeaders are applied in order to the response of the backend
+	ResponseHeaders []HeaderRule `mapstructure:"response_headers"`
 }
 
+// HeaderRule changes a header of the requests or responses of a route, e.g.
+//
+//	{"action": "set", "name": "X-User-Id", "value": "{{.claims.sub}}"}
+//
+// The value is a text/template with the variables of the expression selector, e.g. .method, .host, .path,
+// .headers or .claims. A set whose template refers to a missing value removes the header, so clients can't supply
+// it, an add is skipped.
+type HeaderRule struct {
+	// Action is one of HeaderActions
+	Action string
+	Name   string
+	// Value is the template of the value for add and set, and the new name for rename
+	Value string
+}
+
+// Actions of a header rule.
+const (
+	// HeaderAdd adds a value to the header
+	HeaderAdd = "add"
+	// HeaderSet replaces the values of the header
+	HeaderSet = "set"
+	// HeaderRemove removes the header
+	HeaderRemove = "remove"
+	// HeaderRename moves the values of the header to the header named by the value
+	HeaderRename = "rename"
+)
+
+// HeaderActions lists the actions of a header rule.
+var HeaderActions = []string{HeaderAdd, HeaderSet, HeaderRemove, HeaderRename}
+
+// Forwarding headers sent to the backend of a route. Headers of untrusted clients are never passed on. With the
+// X-Forwarded-* headers the address of the connected client is appended to X-Forwarded-For.
+const (
+	// ForwardedX sends X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix
+	ForwardedX = "x-forwarded"
+	// ForwardedRFC7239 sends only the Forwarded header of RFC 7239
+	ForwardedRFC7239 = "forwarded"
+	// ForwardedBoth sends the X-Forwarded-* and the Forwarded headers
+	ForwardedBoth = "both"
+	// ForwardedNone sends no forwarding headers
+	ForwardedNone = "none"
+)
+
+// ForwardedHeaders lists the values of Route.Forwarded.
+var ForwardedHeaders = []string{ForwardedX, ForwardedRFC7239, ForwardedBoth, ForwardedNone}
+
 // RouteType defines the type of a route
 type RouteType string
 
@@ -72,6 +249,10 @@ var (
 	RouteTypes []RouteType = []RouteType{QueryRoute, RegexRoute, PrefixRoute}
 )
 
+// AccountsService is the name of the accounts service in the registry, used by the migration selector and the
+// middlewares which resolve the accounts.
+const AccountsService = "com.owncloud.api.accounts"
+
 // Reva defines all available REVA configuration.
 type Reva struct {
 	Address string
@@ -79,14 +260,21 @@ type Reva struct {
 
 // Config combines all available configuration parts.
 type Config struct {
-	File           string
-	Log            Log
-	Debug          Debug
-	HTTP           HTTP
+	File      string
+	Log       Log
+	Debug     Debug
+	HTTP      HTTP
+	Listeners []Listener
+	// TrustedProxies are the CIDRs or IP addresses of the proxies whose Forwarded and X-Forwarded-* headers are
+	// honoured, the headers of other clients are ignored
+	TrustedProxies []string      `mapstructure:"trusted_proxies"`
+	HTTPSRedirect  HTTPSRedirect `mapstructure:"https_redirect"`
 	Tracing        Tracing
+	AccessLog      AccessLog `mapstructure:"access_log"`
 	Asset          Asset
 	Policies       []Policy
 	OIDC           OIDC
+	ClientCertAuth ClientCertAuth `mapstructure:"client_cert_auth"`
 	TokenManager   TokenManager
 	PolicySelector *PolicySelector `mapstructure:"policy_selector"`
 	Reva           Reva
@@ -100,10 +288,44 @@ type OIDC struct {
 	Insecure bool
 }
 
+// ClientCertAuth is the config for authenticating requests with TLS client certificates. The proxy asks for a client
+// certificate in the TLS handshake, certificates signed by one of the CAs authenticate the requests to the paths.
+type ClientCertAuth struct {
+	Enabled bool
+	// CA is a PEM file with the CAs client certificates are verified against
+	CA    string
+	Paths []ClientCertPath
+}
+
+// ClientCertPath configures client certificate authentication for requests whose path starts with Prefix.
+type ClientCertPath struct {
+	Prefix string
+	// Required rejects requests without a valid client certificate, otherwise they are authenticated as usual
+	Required bool
+	// Username is the certificate field used as preferred_username, one of "cn", "email", "dns" or "uri"
+	Username string
+}
+
+// Fields of a client certificate which can be used as username.
+const (
+	CertFieldCN    = "cn"
+	CertFieldEmail = "email"
+	CertFieldDNS   = "dns"
+	CertFieldURI   = "uri"
+)
+
+// CertFields lists the fields of a client certificate which can be used as username.
+var CertFields = []string{CertFieldCN, CertFieldEmail, CertFieldDNS, CertFieldURI}
+
 // PolicySelector is the toplevel-configuration for different selectors
 type PolicySelector struct {
-	Static    *StaticSelectorConf
-	Migration *MigrationSelectorConf
+	Static     *StaticSelectorConf
+	Migration  *MigrationSelectorConf
+	Claims     *ClaimsSelectorConf
+	Request    *RequestSelectorConf
+	Canary     *CanarySelectorConf
+	Chain      *ChainSelectorConf
+	Expression *ExpressionSelectorConf
 }
 
 // StaticSelectorConf is the config for the static-policy-selector
@@ -126,6 +348,85 @@ type MigrationSelectorConf struct {
 	AccFoundPolicy        string `mapstructure:"acc_found_policy"`
 	AccNotFoundPolicy     string `mapstructure:"acc_not_found_policy"`
 	UnauthenticatedPolicy string `mapstructure:"unauthenticated_policy"`
+	// Claim identifies the user, defaults to "preferred_username"
+	Claim string
+	// Match is the account property the claim is matched against: "id", "username" (default) or "email"
+	Match string
+	// PositiveCacheTTL is how long a found account is cached
+	PositiveCacheTTL time.Duration `mapstructure:"positive_cache_ttl"`
+	// NegativeCacheTTL is how long a not found account is cached
+	NegativeCacheTTL time.Duration `mapstructure:"negative_cache_ttl"`
+	// OnError is the behaviour when the accounts service fails, either "fail" (default) or "last_known"
+	OnError string `mapstructure:"on_error"`
+	// Cookie is the name of the cookie recording the selected policy, empty disables the cookie
+	Cookie string
+}
+
+// ClaimsSelectorConf is the config for the claims-selector
+type ClaimsSelectorConf struct {
+	DefaultPolicy         string `mapstructure:"default_policy"`
+	UnauthenticatedPolicy string `mapstructure:"unauthenticated_policy"`
+	Rules                 []ClaimsSelectorRule
+}
+
+// ClaimsSelectorRule selects Policy if the value of Claim matches Value. Operator is one of "equals" (default),
+// "contains", "starts_with", "ends_with" or "regex".
+type ClaimsSelectorRule struct {
+	Claim    string
+	Operator string
+	Value    string
+	Policy   string
+}
+
+// RequestSelectorConf is the config for the request-selector
+type RequestSelectorConf struct {
+	DefaultPolicy string `mapstructure:"default_policy"`
+	Rules         []RequestSelectorRule
+}
+
+// RequestSelectorRule selects Policy if the request matches the condition.
+type RequestSelectorRule struct {
+	RequestCondition `mapstructure:",squash"`
+	Policy           string
+}
+
+// RequestCondition matches an attribute of a request. Exactly one of Host, Header, Cookie or Path (a prefix) must be
+// set. Header and Cookie match Value, or their presence if Value is empty.
+type RequestCondition struct {
+	Host   string
+	Header string
+	Cookie string
+	Path   string
+	Value  string
+}
+
+// CanarySelectorConf is the config for the canary-selector
+type CanarySelectorConf struct {
+	Policy                string
+	DefaultPolicy         string `mapstructure:"default_policy"`
+	UnauthenticatedPolicy string `mapstructure:"unauthenticated_policy"`
+	Percentage            int
+	Claim                 string
+	Allow                 []string
+	Deny                  []string
+}
+
+// ChainSelectorConf is the config for the chain-selector
+type ChainSelectorConf struct {
+	Selectors     []ChainSelectorStep
+	DefaultPolicy string `mapstructure:"default_policy"`
+}
+
+// ChainSelectorStep is a selector of a chain which is only evaluated if the request matches When. A step without When
+// is always evaluated.
+type ChainSelectorStep struct {
+	When     *RequestCondition
+	Selector PolicySelector
+}
+
+// ExpressionSelectorConf is the config for the expression-selector
+type ExpressionSelectorConf struct {
+	Expression string
 }
 
 // New initializes a new configuration
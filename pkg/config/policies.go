@@ -0,0 +1,148 @@
+package config
+
+// DefaultPolicies are used if no policies are configured.
+func DefaultPolicies() []Policy {
+	return []Policy{
+		{
+			Name: "reva",
+			Routes: []Route{
+				{
+					Endpoint: "/",
+					Backend:  "http://localhost:9100",
+				},
+				{
+					Endpoint: "/.well-known/",
+					Backend:  "http://localhost:9130",
+				},
+				{
+					Endpoint: "/konnect/",
+					Backend:  "http://localhost:9130",
+				},
+				{
+					Endpoint: "/signin/",
+					Backend:  "http://localhost:9130",
+				},
+				{
+					Type:     RegexRoute,
+					Endpoint: "/ocs/v[12].php/cloud/user", // we have `user` and `users` in ocis-ocs
+					Backend:  "http://localhost:9110",
+				},
+				{
+					Endpoint: "/ocs/",
+					Backend:  "http://localhost:9140",
+				},
+				{
+					Type:     QueryRoute,
+					Endpoint: "/remote.php/?preview=1",
+					Backend:  "http://localhost:9115",
+				},
+				{
+					Endpoint: "/remote.php/",
+					Backend:  "http://localhost:9140",
+				},
+				{
+					Endpoint: "/dav/",
+					Backend:  "http://localhost:9140",
+				},
+				{
+					Endpoint: "/webdav/",
+					Backend:  "http://localhost:9140",
+				},
+				{
+					Endpoint: "/status.php",
+					Backend:  "http://localhost:9140",
+				},
+				{
+					Endpoint: "/index.php/",
+					Backend:  "http://localhost:9140",
+				},
+				{
+					Endpoint: "/data",
+					Backend:  "http://localhost:9140",
+				},
+				// if we were using the go micro api gateway we could look up the endpoint in the registry dynamically
+				{
+					Endpoint: "/api/v0/accounts",
+					Backend:  "http://localhost:9181",
+				},
+				// TODO the lookup needs a better mechanism
+				{
+					Endpoint: "/accounts.js",
+					Backend:  "http://localhost:9181",
+				},
+				{
+					Endpoint: "/api/v0/settings",
+					Backend:  "http://localhost:9190",
+				},
+				{
+					Endpoint: "/settings.js",
+					Backend:  "http://localhost:9190",
+				},
+				{
+					Endpoint: "/api/v0/greet",
+					Backend:  "http://localhost:9105",
+				},
+				{
+					Endpoint: "/hello.js",
+					Backend:  "http://localhost:9105",
+				},
+			},
+		},
+		{
+			Name: "oc10",
+			Routes: []Route{
+				{
+					Endpoint: "/",
+					Backend:  "http://localhost:9100",
+				},
+				{
+					Endpoint: "/.well-known/",
+					Backend:  "http://localhost:9130",
+				},
+				{
+					Endpoint: "/konnect/",
+					Backend:  "http://localhost:9130",
+				},
+				{
+					Endpoint: "/signin/",
+					Backend:  "http://localhost:9130",
+				},
+				{
+					Endpoint:    "/ocs/",
+					Backend:     "https://demo.owncloud.com",
+					ApacheVHost: true,
+				},
+				{
+					Endpoint:    "/remote.php/",
+					Backend:     "https://demo.owncloud.com",
+					ApacheVHost: true,
+				},
+				{
+					Endpoint:    "/dav/",
+					Backend:     "https://demo.owncloud.com",
+					ApacheVHost: true,
+				},
+				{
+					Endpoint:    "/webdav/",
+					Backend:     "https://demo.owncloud.com",
+					ApacheVHost: true,
+				},
+				{
+					Endpoint:    "/status.php",
+					Backend:     "https://demo.owncloud.com",
+					ApacheVHost: true,
+				},
+				{
+					Endpoint:    "/index.php/",
+					Backend:     "https://demo.owncloud.com",
+					ApacheVHost: true,
+				},
+				{
+					Endpoint:    "/data",
+					Backend:     "https://demo.owncloud.com",
+					ApacheVHost: true,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,398 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ValidationError is a problem with the value at Path of the configuration.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors are all problems found in a configuration.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *ValidationErrors) add(path, format string, args ...interface{}) {
+	*e = append(*e, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the configuration and returns all problems as ValidationErrors, or nil if there are none.
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+
+	// the default policies are used if none are configured
+	configured := c.Policies
+	if configured == nil {
+		configured = DefaultPolicies()
+	}
+
+	policies := map[string]bool{}
+	for i, p := range configured {
+		path := fmt.Sprintf("policies[%d]", i)
+		switch {
+		case p.Name == "":
+			errs.add(path+".name", "must not be empty")
+		case policies[p.Name]:
+			errs.add(path+".name", "duplicate policy %q", p.Name)
+		}
+		policies[p.Name] = true
+
+		for j, rt := range p.Routes {
+			validateRoute(&errs, fmt.Sprintf("%s.routes[%d]", path, j), rt)
+		}
+	}
+
+	if c.PolicySelector != nil {
+		validateSelector(&errs, "policy_selector", c.PolicySelector, policies)
+	}
+
+	validateAccessLog(&errs, "access_log", c.AccessLog)
+	if c.HTTP.H2C && c.HTTP.TLS {
+		errs.add("http.h2c", "h2c is only used without tls")
+	}
+	if c.HTTP.HTTP3 && !c.HTTP.TLS {
+		errs.add("http.http3", "http3 needs tls")
+	}
+	validateACME(&errs, "http.acme", c.HTTP)
+	validateListeners(&errs, "listeners", c.Listeners, policies)
+	validateClientCertAuth(&errs, "client_cert_auth", c)
+	validateTrustedProxies(&errs, "trusted_proxies", c.TrustedProxies)
+	validateHTTPSRedirect(&errs, "https_redirect", c.HTTPSRedirect)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateRoute(errs *ValidationErrors, path string, rt Route) {
+	switch rt.Type {
+	case "", PrefixRoute, QueryRoute:
+	case RegexRoute:
+		if _, err := regexp.Compile(rt.Endpoint); err != nil {
+			errs.add(path+".endpoint", "invalid regex: %v", err)
+		}
+	default:
+		errs.add(path+".type", "unknown route type %q, must be one of %v", rt.Type, RouteTypes)
+	}
+
+	if rt.Endpoint == "" {
+		errs.add(path+".endpoint", "must not be empty")
+	}
+
+	u, err := url.Parse(rt.Backend)
+	switch {
+	case rt.Backend == "":
+		errs.add(path+".backend", "must not be empty")
+	case err != nil:
+		errs.add(path+".backend", "malformed url: %v", err)
+	case u.Scheme == "" || u.Host == "":
+		errs.add(path+".backend", "url %q must have a scheme and a host", rt.Backend)
+	}
+
+	switch rt.Forwarded {
+	case "", ForwardedX, ForwardedRFC7239, ForwardedBoth, ForwardedNone:
+	default:
+		errs.add(path+".forwarded", "unknown forwarding headers %q, must be one of %v", rt.Forwarded, ForwardedHeaders)
+	}
+	if rt.ForwardedPrefix != "" && !strings.HasPrefix(rt.ForwardedPrefix, "/") {
+		errs.add(path+".forwarded_prefix", "must start with /")
+	}
+	if rt.PreserveHost && rt.ApacheVHost {
+		errs.add(path+".preserve_host", "can't be used with apache-vhost")
+	}
+	validateHeaderRules(errs, path+".request_headers", rt.RequestHeaders)
+	validateHeaderRules(errs, path+".response_headers", rt.ResponseHeaders)
+}
+
+func validateHeaderRules(errs *ValidationErrors, path string, rules []HeaderRule) {
+	for i, h := range rules {
+		hPath := fmt.Sprintf("%s[%d]", path, i)
+		if h.Name == "" {
+			errs.add(hPath+".name", "must not be empty")
+		}
+		switch h.Action {
+		case HeaderAdd, HeaderSet:
+			if _, err := template.New("header").Parse(h.Value); err != nil {
+				errs.add(hPath+".value", "invalid template: %v", err)
+			}
+		case HeaderRename:
+			if h.Value == "" {
+				errs.add(hPath+".value", "must be the new name of the header")
+			}
+		case HeaderRemove:
+		default:
+			errs.add(hPath+".action", "unknown action %q, must be one of %v", h.Action, HeaderActions)
+		}
+	}
+}
+
+// validateSelector checks that exactly one selector is configured and that the selector only references configured
+// policies. Empty policy names are not checked, they fall through in chains.
+func validateSelector(errs *ValidationErrors, path string, s *PolicySelector, policies map[string]bool) {
+	ref := func(p, policy string) {
+		if policy != "" && !policies[policy] {
+			errs.add(p, "unknown policy %q", policy)
+		}
+	}
+
+	configured := 0
+	if s.Static != nil {
+		configured++
+		ref(path+".static.policy", s.Static.Policy)
+	}
+	if s.Migration != nil {
+		configured++
+		ref(path+".migration.acc_found_policy", s.Migration.AccFoundPolicy)
+		ref(path+".migration.acc_not_found_policy", s.Migration.AccNotFoundPolicy)
+		ref(path+".migration.unauthenticated_policy", s.Migration.UnauthenticatedPolicy)
+		if s.Migration.PositiveCacheTTL < 0 {
+			errs.add(path+".migration.positive_cache_ttl", "must not be negative")
+		}
+		if s.Migration.NegativeCacheTTL < 0 {
+			errs.add(path+".migration.negative_cache_ttl", "must not be negative")
+		}
+	}
+	if s.Claims != nil {
+		configured++
+		ref(path+".claims.default_policy", s.Claims.DefaultPolicy)
+		ref(path+".claims.unauthenticated_policy", s.Claims.UnauthenticatedPolicy)
+		for i, r := range s.Claims.Rules {
+			if r.Claim == "" {
+				errs.add(fmt.Sprintf("%s.claims.rules[%d].claim", path, i), "must not be empty")
+			}
+			ref(fmt.Sprintf("%s.claims.rules[%d].policy", path, i), r.Policy)
+		}
+	}
+	if s.Request != nil {
+		configured++
+		ref(path+".request.default_policy", s.Request.DefaultPolicy)
+		for i, r := range s.Request.Rules {
+			ref(fmt.Sprintf("%s.request.rules[%d].policy", path, i), r.Policy)
+		}
+	}
+	if s.Canary != nil {
+		configured++
+		ref(path+".canary.policy", s.Canary.Policy)
+		ref(path+".canary.default_policy", s.Canary.DefaultPolicy)
+		ref(path+".canary.unauthenticated_policy", s.Canary.UnauthenticatedPolicy)
+		if s.Canary.Percentage < 0 || s.Canary.Percentage > 100 {
+			errs.add(path+".canary.percentage", "must be between 0 and 100")
+		}
+	}
+	if s.Chain != nil {
+		configured++
+		ref(path+".chain.default_policy", s.Chain.DefaultPolicy)
+		for i := range s.Chain.Selectors {
+			validateSelector(errs, fmt.Sprintf("%s.chain.selectors[%d].selector", path, i), &s.Chain.Selectors[i].Selector, policies)
+		}
+	}
+	if s.Expression != nil {
+		configured++
+		if s.Expression.Expression == "" {
+			errs.add(path+".expression.expression", "must not be empty")
+		}
+	}
+
+	switch {
+	case configured == 0:
+		errs.add(path, "no selector configured")
+	case configured > 1:
+		errs.add(path, "only one selector can be configured")
+	}
+}
+
+func validateAccessLog(errs *ValidationErrors, path string, l AccessLog) {
+	if !l.Enabled {
+		return
+	}
+
+	switch l.Format {
+	case "json", "combined":
+	case "template":
+		if _, err := template.New("access_log").Parse(l.Template); err != nil {
+			errs.add(path+".template", "invalid template: %v", err)
+		}
+	default:
+		errs.add(path+".format", "unknown format %q, must be one of json, combined or template", l.Format)
+	}
+
+	for i, s := range l.Sampling {
+		if s.Rate < 0 || s.Rate > 1 {
+			errs.add(fmt.Sprintf("%s.sampling[%d].rate", path, i), "must be between 0 and 1")
+		}
+	}
+}
+
+func validateACME(errs *ValidationErrors, path string, h HTTP) {
+	a := h.ACME
+	if !a.Enabled {
+		return
+	}
+
+	if !h.TLS {
+		errs.add(path+".enabled", "acme needs tls to be enabled")
+	}
+	if len(a.Domains) == 0 {
+		errs.add(path+".domains", "must not be empty")
+	}
+	for i, d := range a.Domains {
+		if d == "" || strings.ContainsAny(d, "/:* ") {
+			errs.add(fmt.Sprintf("%s.domains[%d]", path, i), "invalid domain %q", d)
+		}
+	}
+	if u, err := url.Parse(a.DirectoryURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		errs.add(path+".directory_url", "must be an https URL, got %q", a.DirectoryURL)
+	}
+	if a.CacheDir == "" {
+		errs.add(path+".cache_dir", "must not be empty")
+	}
+	if a.RenewBefore < 0 {
+		errs.add(path+".renew_before", "must not be negative")
+	}
+}
+
+func validateClientCertAuth(errs *ValidationErrors, path string, c *Config) {
+	a := c.ClientCertAuth
+	if !a.Enabled {
+		return
+	}
+
+	if !c.HTTP.TLS {
+		errs.add(path+".enabled", "client certificates need tls to be enabled")
+	}
+	if a.CA == "" {
+		errs.add(path+".ca", "must not be empty")
+	}
+	if len(a.Paths) == 0 {
+		errs.add(path+".paths", "must not be empty")
+	}
+	for i, p := range a.Paths {
+		pathPath := fmt.Sprintf("%s.paths[%d]", path, i)
+		if !strings.HasPrefix(p.Prefix, "/") {
+			errs.add(pathPath+".prefix", "must start with /")
+		}
+		switch p.Username {
+		case "", CertFieldCN, CertFieldEmail, CertFieldDNS, CertFieldURI:
+		default:
+			errs.add(pathPath+".username", "unknown certificate field %q, must be one of %v", p.Username, CertFields)
+		}
+	}
+}
+
+func validateTrustedProxies(errs *ValidationErrors, path string, proxies []string) {
+	for i, p := range proxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			errs.add(fmt.Sprintf("%s[%d]", path, i), "invalid CIDR or IP address %q", p)
+		}
+	}
+}
+
+func validateHTTPSRedirect(errs *ValidationErrors, path string, r HTTPSRedirect) {
+	for i, h := range r.Hosts {
+		if h == "" || strings.ContainsAny(h, "/:@ ") {
+			errs.add(fmt.Sprintf("%s.hosts[%d]", path, i), "invalid host %q", h)
+		}
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		errs.add(path+".port", "must be between 0 and 65535")
+	}
+	if r.HSTS.MaxAge < 0 {
+		errs.add(path+".hsts.max_age", "must not be negative")
+	}
+	if r.HSTS.Preload {
+		if r.HSTS.MaxAge < 365*24*time.Hour {
+			errs.add(path+".hsts.max_age", "preload needs a max age of at least one year")
+		}
+		if !r.HSTS.IncludeSubdomains {
+			errs.add(path+".hsts.include_subdomains", "preload needs subdomains to be included")
+		}
+	}
+}
+
+func validateListeners(errs *ValidationErrors, path string, listeners []Listener, policies map[string]bool) {
+	middlewares := map[string]bool{}
+	for _, m := range ListenerMiddlewares {
+		middlewares[m] = true
+	}
+
+	names := map[string]bool{}
+	for i, l := range listeners {
+		lPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case l.Name == "":
+			errs.add(lPath+".name", "must not be empty")
+		case names[l.Name]:
+			errs.add(lPath+".name", "duplicate listener %q", l.Name)
+		}
+		names[l.Name] = true
+
+		if l.Addr == "" || l.Addr == "unix:" {
+			errs.add(lPath+".addr", "must not be empty")
+		}
+		if l.TLS && l.H2C {
+			errs.add(lPath+".h2c", "h2c is only used without tls")
+		}
+		for j, m := range l.Middlewares {
+			if !middlewares[m] {
+				errs.add(fmt.Sprintf("%s.middlewares[%d]", lPath, j), "unknown middleware %q, must be one of %v", m, ListenerMiddlewares)
+			}
+		}
+		for j, p := range l.Policies {
+			if !policies[p] {
+				errs.add(fmt.Sprintf("%s.policies[%d]", lPath, j), "unknown policy %q", p)
+			}
+		}
+	}
+}
+
+// UnknownKeys returns the keys of the raw settings, e.g. viper.AllSettings(), which do not map to the configuration.
+func UnknownKeys(settings map[string]interface{}) ([]string, error) {
+	var md mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Metadata:         &md,
+		Result:           New(),
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decoder.Decode(settings); err != nil {
+		return nil, err
+	}
+
+	// the metadata uses the field names for the parents of a key, the settings are lowercase
+	unknown := make([]string, 0, len(md.Unused))
+	for _, key := range md.Unused {
+		unknown = append(unknown, strings.ToLower(key))
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
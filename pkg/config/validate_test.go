@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{
+		Policies: []Policy{
+			{Name: "reva", Routes: []Route{
+				{Endpoint: "/", Backend: "http://localhost:9140"},
+				{Type: "regexp", Endpoint: "/ocs/", Backend: "http://localhost:9110"},
+				{Type: RegexRoute, Endpoint: "/ocs/(", Backend: "localhost:9110"},
+				{Endpoint: "/dav/", Backend: "https://oc10.example.com", Forwarded: "x-real-ip", ForwardedPrefix: "dav", PreserveHost: true, ApacheVHost: true},
+				{Endpoint: "/web/", Backend: "http://localhost:9100",
+					RequestHeaders: []HeaderRule{
+						{Action: HeaderSet, Name: "X-User-Id", Value: "{{.claims.sub}}"},
+						{Action: "append", Name: "X-Foo"},
+						{Action: HeaderAdd, Name: "X-Bar", Value: "{{.claims.sub"},
+					},
+					ResponseHeaders: []HeaderRule{
+						{Action: HeaderRename, Name: "X-Backend"},
+						{Action: HeaderRemove},
+					},
+				},
+			}},
+			{Name: "reva"},
+		},
+		PolicySelector: &PolicySelector{
+			Chain: &ChainSelectorConf{
+				DefaultPolicy: "oc10",
+				Selectors: []ChainSelectorStep{
+					{Selector: PolicySelector{Static: &StaticSelectorConf{Policy: "reva"}}},
+					{Selector: PolicySelector{}},
+					{Selector: PolicySelector{Migration: &MigrationSelectorConf{AccFoundPolicy: "reva", NegativeCacheTTL: -time.Minute}}},
+				},
+			},
+		},
+		AccessLog: AccessLog{Enabled: true, Format: "xml"},
+		Listeners: []Listener{
+			{Name: "internal", Addr: "127.0.0.1:9201", Middlewares: []string{"access_log"}, Policies: []string{"reva"}},
+			{Name: "internal", Addr: "unix:", Middlewares: []string{"oidc", "basic_auth"}, Policies: []string{"oc10"}},
+		},
+		HTTP: HTTP{HTTP3: true, ACME: ACME{
+			Enabled:      true,
+			Domains:      []string{"cloud.example.com", "*.example.com"},
+			DirectoryURL: "http://localhost:14000/dir",
+			CacheDir:     "acme",
+		}},
+		TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1", "proxy.example.com"},
+		HTTPSRedirect: HTTPSRedirect{
+			Hosts: []string{"cloud.example.com", "cloud.example.com:8443"},
+			HSTS:  HSTS{MaxAge: time.Hour, Preload: true},
+		},
+	}
+
+	var errs ValidationErrors
+	if err := cfg.Validate(); !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors got %v", err)
+	}
+
+	want := []string{
+		"policies[0].routes[1].type",
+		"policies[0].routes[2].endpoint",
+		"policies[0].routes[2].backend",
+		"policies[0].routes[3].forwarded",
+		"policies[0].routes[3].forwarded_prefix",
+		"policies[0].routes[3].preserve_host",
+		"policies[0].routes[4].request_headers[1].action",
+		"policies[0].routes[4].request_headers[2].value",
+		"policies[0].routes[4].response_headers[0].value",
+		"policies[0].routes[4].response_headers[1].name",
+		"policies[1].name",
+		"policy_selector.chain.default_policy",
+		"policy_selector.chain.selectors[1].selector",
+		"policy_selector.chain.selectors[2].selector.migration.negative_cache_ttl",
+		"access_log.format",
+		"http.http3",
+		"http.acme.enabled",
+		"http.acme.domains[1]",
+		"http.acme.directory_url",
+		"listeners[1].name",
+		"listeners[1].addr",
+		"listeners[1].middlewares[1]",
+		"listeners[1].policies[0]",
+		"trusted_proxies[2]",
+		"https_redirect.hosts[1]",
+		"https_redirect.hsts.max_age",
+		"https_redirect.hsts.include_subdomains",
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Path)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected problems at %v got %v", want, errs)
+	}
+
+	cfg = &Config{
+		Policies:       []Policy{{Name: "reva", Routes: []Route{{Endpoint: "/", Backend: "http://localhost:9140"}}}},
+		PolicySelector: &PolicySelector{Static: &StaticSelectorConf{Policy: "reva"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// without policies the selector refers to the default policies
+	cfg = &Config{
+		PolicySelector: &PolicySelector{Static: &StaticSelectorConf{Policy: "reva"}},
+		Listeners:      []Listener{{Name: "internal", Addr: "127.0.0.1:9201", Policies: []string{"oc10"}}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	settings := map[string]interface{}{
+		"htpp": map[string]interface{}{"addr": "0.0.0.0:9200"},
+		"policies": []interface{}{
+			map[string]interface{}{
+				"name": "reva",
+				"routes": []interface{}{
+					map[string]interface{}{"endpoint": "/", "backnd": "http://localhost:9140", "apache-vhost": true},
+				},
+			},
+		},
+		"policy_selector": map[string]interface{}{
+			"migration": map[string]interface{}{"acc_found_policy": "reva", "acc_not_found": "oc10"},
+		},
+	}
+
+	got, err := UnknownKeys(settings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"htpp", "policies[0].routes[0].backnd", "policy_selector.migration.acc_not_found"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v got %v", want, got)
+	}
+}
@@ -0,0 +1,54 @@
+package crypto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewACMEManager returns a certificate manager which obtains certificates for the configured domains from an ACME
+// certificate authority and renews them before they expire. Certificates are requested when the first TLS handshake
+// for a domain arrives. Use its TLSConfig for TLS-ALPN-01 challenges and its HTTPHandler for HTTP-01 challenges.
+func NewACMEManager(cfg config.ACME) (*autocert.Manager, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, errors.New("acme needs at least one domain")
+	}
+	if cfg.CacheDir == "" {
+		return nil, errors.New("acme needs a cache directory")
+	}
+
+	client := &acme.Client{DirectoryURL: cfg.DirectoryURL}
+	if cfg.CACert != "" {
+		pem, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read acme ca certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACert)
+		}
+
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(cfg.CacheDir),
+		HostPolicy:  autocert.HostWhitelist(cfg.Domains...),
+		RenewBefore: cfg.RenewBefore,
+		Client:      client,
+		Email:       cfg.Email,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+)
+
+func TestNewACMEManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a local ACME server with a self signed certificate
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   "https://" + r.Host + "/nonce",
+			"newAccount": "https://" + r.Host + "/account",
+			"newOrder":   "https://" + r.Host + "/order",
+		})
+	}))
+	defer srv.Close()
+
+	caCert := filepath.Join(dir, "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caCert, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.ACME{
+		Domains:      []string{"cloud.example.com"},
+		DirectoryURL: srv.URL + "/dir",
+		CACert:       caCert,
+		CacheDir:     filepath.Join(dir, "cache"),
+	}
+	m, err := NewACMEManager(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	d, err := m.Client.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Could not talk to the ACME server with its ca certificate: %v", err)
+	}
+	if d.OrderURL != srv.URL+"/order" {
+		t.Errorf("Expected order url %s got %s", srv.URL+"/order", d.OrderURL)
+	}
+
+	if err := m.HostPolicy(context.Background(), "cloud.example.com"); err != nil {
+		t.Errorf("Expected cloud.example.com to be allowed: %v", err)
+	}
+	if err := m.HostPolicy(context.Background(), "evil.example.com"); err == nil {
+		t.Error("Expected evil.example.com not to be allowed")
+	}
+
+	for _, broken := range []config.ACME{
+		{CacheDir: "acme"},
+		{Domains: []string{"cloud.example.com"}},
+		{Domains: []string{"cloud.example.com"}, CacheDir: "acme", CACert: filepath.Join(dir, "missing.pem")},
+	} {
+		if _, err := NewACMEManager(broken); err == nil {
+			t.Errorf("Expected an error for %+v", broken)
+		}
+	}
+}
+
+// TestACMEPebble obtains a certificate from a running Pebble (https://github.com/letsencrypt/pebble) test server with
+// the TLS-ALPN-01 challenge. To run it start pebble-challtestsrv -defaultIPv4 127.0.0.1 and pebble -dnsserver
+// 127.0.0.1:8053, then set PEBBLE_CA_CERT to pebble's test/certs/pebble.minica.pem and PEBBLE_DOMAIN to any domain
+// with at least two labels, e.g. proxy.example.com.
+func TestACMEPebble(t *testing.T) {
+	caCert, domain := os.Getenv("PEBBLE_CA_CERT"), os.Getenv("PEBBLE_DOMAIN")
+	if caCert == "" || domain == "" {
+		t.Skip("PEBBLE_CA_CERT and PEBBLE_DOMAIN are not set")
+	}
+
+	dir, err := ioutil.TempDir("", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := NewACMEManager(config.ACME{
+		Domains:      []string{domain},
+		DirectoryURL: "https://localhost:14000/dir",
+		CACert:       caCert,
+		CacheDir:     dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pebble validates TLS-ALPN-01 challenges on port 5001
+	ln, err := tls.Listen("tcp", ":5001", m.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, http.NotFoundHandler())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", "localhost:5001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the first handshake for the domain obtains the certificate
+	client := tls.Client(conn, &tls.Config{ServerName: domain, InsecureSkipVerify: true})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("Could not obtain a certificate: %v", err)
+	}
+	if names := client.ConnectionState().PeerCertificates[0].DNSNames; len(names) != 1 || names[0] != domain {
+		t.Errorf("Expected a certificate for %s got %v", domain, names)
+	}
+
+	if _, err := m.Cache.Get(ctx, domain); err != nil {
+		t.Errorf("Expected the certificate to be cached: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package crypto
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/owncloud/ocis-pkg/v2/log"
+)
+
+// CertStore serves the certificate matching the server name (SNI) of a TLS handshake. The certificates are loaded
+// from a cert/key pair and a directory containing <name>.crt and <name>.key pairs. Reload picks up changed files, e.g.
+// certificates rotated by cert-manager, without restarting the proxy.
+type CertStore struct {
+	logger   log.Logger
+	certFile string
+	keyFile  string
+	dir      string
+
+	mu       sync.RWMutex
+	byName   map[string]*tls.Certificate
+	fallback *tls.Certificate
+	stamps   map[string]time.Time
+}
+
+// NewCertStore loads the certificates of the cert/key pair and of dir, both are optional but one is required.
+func NewCertStore(l log.Logger, certFile, keyFile, dir string) (*CertStore, error) {
+	if (certFile == "" || keyFile == "") && dir == "" {
+		return nil, errors.New("neither a certificate nor a certificate directory is configured")
+	}
+
+	s := &CertStore{
+		logger:   l,
+		certFile: certFile,
+		keyFile:  keyFile,
+		dir:      dir,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetCertificate returns the certificate for the server name of the handshake, it is used as tls.Config.GetCertificate.
+// Wildcard certificates match one label. Handshakes without or with an unknown server name get the cert/key pair, or
+// the first certificate of the directory.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if c, ok := s.byName[name]; ok {
+		return c, nil
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		if c, ok := s.byName["*"+name[i:]]; ok {
+			return c, nil
+		}
+	}
+	if s.fallback == nil {
+		return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+	}
+	return s.fallback, nil
+}
+
+// Reload loads the certificates again if a file changed. The current certificates are kept when loading fails.
+func (s *CertStore) Reload() (bool, error) {
+	stamps, err := s.fileStamps()
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	changed := !sameStamps(stamps, s.stamps)
+	s.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+	return true, s.load()
+}
+
+// Watch reloads the certificates every interval until ctx is done.
+func (s *CertStore) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			changed, err := s.Reload()
+			switch {
+			case err != nil:
+				s.logger.Error().Err(err).Msg("Could not reload the tls certificates, keeping the current ones")
+			case changed:
+				s.logger.Info().Msg("Reloaded the tls certificates")
+			}
+		}
+	}
+}
+
+func (s *CertStore) load() error {
+	stamps, err := s.fileStamps()
+	if err != nil {
+		return err
+	}
+
+	byName := map[string]*tls.Certificate{}
+	var fallback *tls.Certificate
+
+	add := func(certFile, keyFile string) error {
+		c, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("could not load %s: %w", certFile, err)
+		}
+		if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return fmt.Errorf("could not parse %s: %w", certFile, err)
+		}
+
+		names := c.Leaf.DNSNames
+		if len(names) == 0 && c.Leaf.Subject.CommonName != "" {
+			names = []string{c.Leaf.Subject.CommonName}
+		}
+		for _, n := range names {
+			n = strings.ToLower(n)
+			// the first certificate for a name wins
+			if _, ok := byName[n]; !ok {
+				byName[n] = &c
+			}
+		}
+		if fallback == nil {
+			fallback = &c
+		}
+		return nil
+	}
+
+	if s.certFile != "" && s.keyFile != "" {
+		if err := add(s.certFile, s.keyFile); err != nil {
+			return err
+		}
+	}
+	if s.dir != "" {
+		pairs, err := s.dirPairs()
+		if err != nil {
+			return err
+		}
+		for _, p := range pairs {
+			if err := add(p[0], p[1]); err != nil {
+				return err
+			}
+		}
+	}
+	if fallback == nil {
+		return fmt.Errorf("no certificates found in %s", s.dir)
+	}
+
+	s.mu.Lock()
+	s.byName, s.fallback, s.stamps = byName, fallback, stamps
+	s.mu.Unlock()
+	return nil
+}
+
+// dirPairs returns the <name>.crt and <name>.key pairs of the directory, sorted by name.
+func (s *CertStore) dirPairs() ([][2]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the certificate directory: %w", err)
+	}
+
+	var pairs [][2]string
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".crt" {
+			continue
+		}
+		certFile := filepath.Join(s.dir, info.Name())
+		keyFile := strings.TrimSuffix(certFile, ".crt") + ".key"
+		if _, err := os.Stat(keyFile); err != nil {
+			// certificates without key, e.g. of a CA, are ignored
+			continue
+		}
+		pairs = append(pairs, [2]string{certFile, keyFile})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	return pairs, nil
+}
+
+// fileStamps returns the modification times of all certificate and key files. os.Stat follows symlinks, so
+// atomically swapped symlinks, as used for kubernetes secrets, are detected as well.
+func (s *CertStore) fileStamps() (map[string]time.Time, error) {
+	var files []string
+	if s.certFile != "" && s.keyFile != "" {
+		files = append(files, s.certFile, s.keyFile)
+	}
+	if s.dir != "" {
+		pairs, err := s.dirPairs()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pairs {
+			files = append(files, p[0], p[1])
+		}
+	}
+
+	stamps := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		stamps[f] = info.ModTime()
+	}
+	return stamps, nil
+}
+
+func sameStamps(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, t := range a {
+		if !b[f].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
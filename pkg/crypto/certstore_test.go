@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/owncloud/ocis-pkg/v2/log"
+)
+
+func TestCertStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCert(t, dir, "a", "a.example.com")
+	writeCert(t, dir, "b", "*.b.example.com")
+
+	s, err := NewCertStore(log.NewLogger(), "", "", dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for serverName, want := range map[string]string{
+		"a.example.com":       "a.example.com",
+		"A.EXAMPLE.COM.":      "a.example.com",
+		"files.b.example.com": "*.b.example.com",
+		"b.example.com":       "a.example.com",
+		"":                    "a.example.com",
+	} {
+		if got := servedName(t, s, serverName); got != want {
+			t.Errorf("Expected the certificate for %s to be %s got %s", serverName, want, got)
+		}
+	}
+
+	if changed, err := s.Reload(); changed || err != nil {
+		t.Errorf("Expected no reload got %v, %v", changed, err)
+	}
+
+	// a rotated certificate
+	writeCert(t, dir, "a", "c.example.com")
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "a.crt"), future, future)
+	if changed, err := s.Reload(); !changed || err != nil {
+		t.Fatalf("Expected a reload got %v, %v", changed, err)
+	}
+	if got := servedName(t, s, "c.example.com"); got != "c.example.com" {
+		t.Errorf("Expected the rotated certificate got %s", got)
+	}
+
+	// a broken certificate keeps the current ones
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.crt"), []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "a.crt"), future, future)
+	if _, err := s.Reload(); err == nil {
+		t.Error("Expected an error for a broken certificate")
+	}
+	if got := servedName(t, s, "c.example.com"); got != "c.example.com" {
+		t.Errorf("Expected the current certificate to be kept got %s", got)
+	}
+
+	if _, err := NewCertStore(log.NewLogger(), "", "", ""); err == nil {
+		t.Error("Expected an error without certificates")
+	}
+}
+
+func TestTLSSettings(t *testing.T) {
+	if v, err := TLSVersion("1.3"); err != nil || v != tls.VersionTLS13 {
+		t.Errorf("Expected tls 1.3 got %v, %v", v, err)
+	}
+	if _, err := TLSVersion("1.4"); err == nil {
+		t.Error("Expected an error for tls 1.4")
+	}
+
+	ids, err := CipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "tls_ecdhe_ecdsa_with_aes_256_gcm_sha384"})
+	if err != nil || len(ids) != 2 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Unexpected cipher suites %v, %v", ids, err)
+	}
+	if _, err := CipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("Expected an error for an insecure cipher suite")
+	}
+}
+
+func servedName(t *testing.T, s *CertStore, serverName string) string {
+	c, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatalf("Unexpected error for %s: %v", serverName, err)
+	}
+	return c.Leaf.DNSNames[0]
+}
+
+func writeCert(t *testing.T, dir, name, dnsName string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
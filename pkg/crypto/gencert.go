@@ -1,82 +1,142 @@
 package crypto
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
+	"io/ioutil"
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/owncloud/ocis-pkg/v2/log"
 )
 
-func publicKey(priv interface{}) interface{} {
-	switch k := priv.(type) {
-	case *rsa.PrivateKey:
-		return &k.PublicKey
-	case *ecdsa.PrivateKey:
-		return &k.PublicKey
-	default:
-		return nil
-	}
+// Key types supported by GenCert.
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
+// DefaultKeyType is used by GenCert and the gencert command unless another key type is set.
+const DefaultKeyType = KeyTypeECDSA
+
+// KeyTypes lists the supported key types.
+var KeyTypes = []string{KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519}
+
+// File names written by GenCert.
+const (
+	CertFile   = "server.crt"
+	KeyFile    = "server.key"
+	CACertFile = "ca.crt"
+	CAKeyFile  = "ca.key"
+)
+
+// GenCertOption defines a single option of GenCert.
+type GenCertOption func(o *GenCertOptions)
+
+// GenCertOptions defines the available options of GenCert.
+type GenCertOptions struct {
+	KeyType  string
+	Hosts    []string
+	OutDir   string
+	CA       bool
+	ValidFor time.Duration
 }
 
-func pemBlockForKey(priv interface{}, l log.Logger) *pem.Block {
-	switch k := priv.(type) {
-	case *rsa.PrivateKey:
-		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
-	case *ecdsa.PrivateKey:
-		b, err := x509.MarshalECPrivateKey(k)
-		if err != nil {
-			l.Fatal().Err(err).Msg("Unable to marshal ECDSA private key")
-		}
-		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
-	default:
-		return nil
+func newGenCertOptions(opts ...GenCertOption) GenCertOptions {
+	opt := GenCertOptions{
+		KeyType:  DefaultKeyType,
+		Hosts:    []string{"127.0.0.1", "localhost"},
+		OutDir:   ".",
+		ValidFor: 365 * 24 * time.Hour,
+	}
+
+	for _, o := range opts {
+		o(&opt)
 	}
+
+	return opt
 }
 
-// GenCert generates TLS-Certificates
-func GenCert(l log.Logger) error {
-	var priv interface{}
-	var err error
+// KeyType sets the type of the generated keys, one of KeyTypes.
+func KeyType(val string) GenCertOption {
+	return func(o *GenCertOptions) {
+		o.KeyType = val
+	}
+}
 
-	priv, err = rsa.GenerateKey(rand.Reader, 2048)
+// Hosts sets the hostnames and IP addresses the certificate is valid for.
+func Hosts(val ...string) GenCertOption {
+	return func(o *GenCertOptions) {
+		o.Hosts = val
+	}
+}
 
-	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to generate private key")
+// OutDir sets the directory the files are written to.
+func OutDir(val string) GenCertOption {
+	return func(o *GenCertOptions) {
+		o.OutDir = val
 	}
+}
 
-	notBefore := time.Now()
-	notAfter := notBefore.Add(24 * time.Hour * 365)
+// CA signs the certificate with a local CA instead of self signing it. The CA is created if ca.crt and ca.key do
+// not exist in the output directory yet, otherwise the existing CA is used.
+func CA(val bool) GenCertOption {
+	return func(o *GenCertOptions) {
+		o.CA = val
+	}
+}
 
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
-	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to generate serial number")
+// ValidFor sets how long the certificates are valid.
+func ValidFor(val time.Duration) GenCertOption {
+	return func(o *GenCertOptions) {
+		o.ValidFor = val
 	}
+}
 
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"Acme Corp"},
-			CommonName:   "OCIS",
-		},
-		NotBefore: notBefore,
-		NotAfter:  notAfter,
+// GenCert generates a key and a certificate for the hosts and writes them to server.key and server.crt in the output
+// directory. Without options it generates a self signed ECDSA certificate for localhost in the current directory.
+func GenCert(l log.Logger, opts ...GenCertOption) error {
+	options := newGenCertOptions(opts...)
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
+	if len(options.Hosts) == 0 {
+		return fmt.Errorf("the certificate needs at least one host")
+	}
+	if err := os.MkdirAll(options.OutDir, 0700); err != nil {
+		return fmt.Errorf("could not create the output directory: %w", err)
+	}
+
+	priv, err := generateKey(options.KeyType)
+	if err != nil {
+		return err
 	}
 
-	hosts := []string{"127.0.0.1", "localhost"}
-	for _, h := range hosts {
+	template, err := certTemplate(options.ValidFor)
+	if err != nil {
+		return err
+	}
+	template.Subject = pkix.Name{
+		Organization: []string{"OCIS"},
+		CommonName:   options.Hosts[0],
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := priv.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range options.Hosts {
 		if ip := net.ParseIP(h); ip != nil {
 			template.IPAddresses = append(template.IPAddresses, ip)
 		} else {
@@ -84,40 +144,149 @@ func GenCert(l log.Logger) error {
 		}
 	}
 
-	//template.IsCA = true
-	//template.KeyUsage |= x509.KeyUsageCertSign
+	parent, parentKey := template, priv
+	if options.CA {
+		if parent, parentKey, err = loadOrCreateCA(l, options); err != nil {
+			return err
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, priv.Public(), parentKey)
+	if err != nil {
+		return fmt.Errorf("could not create the certificate: %w", err)
+	}
+
+	return writeKeyPair(l, options.OutDir, CertFile, KeyFile, der, priv)
+}
+
+// loadOrCreateCA returns the CA of the output directory, it is created if it does not exist.
+func loadOrCreateCA(l log.Logger, options GenCertOptions) (*x509.Certificate, crypto.Signer, error) {
+	certFile := filepath.Join(options.OutDir, CACertFile)
+	keyFile := filepath.Join(options.OutDir, CAKeyFile)
+
+	// an existing CA certificate is never replaced, the certificates signed by it would no longer be trusted
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	switch {
+	case certErr == nil && keyErr == nil:
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not load the CA: %w", err)
+		}
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not parse %s: %w", certFile, err)
+		}
+		l.Info().Str("file", certFile).Msg("Using existing CA")
+		return ca, pair.PrivateKey.(crypto.Signer), nil
+	case !os.IsNotExist(certErr) || !os.IsNotExist(keyErr):
+		return nil, nil, fmt.Errorf("could not load the CA, %s and %s must both exist or both be missing", certFile, keyFile)
+	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, publicKey(priv), priv)
+	priv, err := generateKey(options.KeyType)
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to create certificate")
+		return nil, nil, err
 	}
 
-	certOut, err := os.Create("server.crt")
+	// the CA outlives the certificates it signs
+	template, err := certTemplate(10 * options.ValidFor)
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to open server.crt for writing")
+		return nil, nil, err
 	}
-	err = pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	template.Subject = pkix.Name{
+		Organization: []string{"OCIS"},
+		CommonName:   "OCIS local CA",
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to encode certificate")
+		return nil, nil, fmt.Errorf("could not create the CA certificate: %w", err)
+	}
+	if err := writeKeyPair(l, options.OutDir, CACertFile, CAKeyFile, der, priv); err != nil {
+		return nil, nil, err
 	}
-	err = certOut.Close()
+
+	ca, err := x509.ParseCertificate(der)
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to write cert")
+		return nil, nil, err
 	}
-	l.Info().Msg("Written server.crt")
+	return ca, priv, nil
+}
 
-	keyOut, err := os.OpenFile("server.key", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+func certTemplate(validFor time.Duration) (*x509.Certificate, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to open server.key for writing")
+		return nil, fmt.Errorf("could not generate a serial number: %w", err)
 	}
-	err = pem.Encode(keyOut, pemBlockForKey(priv, l))
+
+	notBefore := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validFor),
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+func generateKey(keyType string) (crypto.Signer, error) {
+	var priv crypto.Signer
+	var err error
+
+	switch keyType {
+	case KeyTypeRSA:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeECDSA:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeEd25519:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown key type %q, must be one of %v", keyType, KeyTypes)
+	}
+
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to encode key")
+		return nil, fmt.Errorf("could not generate the private key: %w", err)
 	}
-	err = keyOut.Close()
+	return priv, nil
+}
+
+func pemBlockForKey(priv crypto.Signer) (*pem.Block, error) {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal the ECDSA private key: %w", err)
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}, nil
+	default:
+		b, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal the private key: %w", err)
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: b}, nil
+	}
+}
+
+func writeKeyPair(l log.Logger, dir, certName, keyName string, der []byte, priv crypto.Signer) error {
+	keyBlock, err := pemBlockForKey(priv)
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to write key")
+		return err
+	}
+
+	certFile := filepath.Join(dir, certName)
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", certFile, err)
+	}
+	l.Info().Msgf("Written %s", certFile)
+
+	keyFile := filepath.Join(dir, keyName)
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(keyBlock), 0600); err != nil {
+		return fmt.Errorf("could not write %s: %w", keyFile, err)
 	}
-	l.Info().Msg("Written server.key")
+	l.Info().Msgf("Written %s", keyFile)
 	return nil
 }
@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/owncloud/ocis-pkg/v2/log"
+)
+
+func TestGenCert(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gencert")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			err = GenCert(log.NewLogger(), KeyType(keyType), Hosts("cloud.example.com", "10.0.0.1"), OutDir(dir), CA(true))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			pair, err := tls.LoadX509KeyPair(filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile))
+			if err != nil {
+				t.Fatalf("Could not load the key pair: %v", err)
+			}
+			cert, err := x509.ParseCertificate(pair.Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			caPEM, err := ioutil.ReadFile(filepath.Join(dir, CACertFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(caPEM)
+
+			for _, host := range []string{"cloud.example.com", "10.0.0.1"} {
+				if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+					t.Errorf("Certificate is not valid for %s: %v", host, err)
+				}
+			}
+
+			// a second certificate is signed by the existing CA
+			err = GenCert(log.NewLogger(), KeyType(keyType), Hosts("files.example.com"), OutDir(dir), CA(true))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			pair, err = tls.LoadX509KeyPair(filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, _ = x509.ParseCertificate(pair.Certificate[0])
+			if _, err := cert.Verify(x509.VerifyOptions{DNSName: "files.example.com", Roots: roots}); err != nil {
+				t.Errorf("Certificate is not signed by the existing CA: %v", err)
+			}
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "gencert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := GenCert(log.NewLogger(), OutDir(dir), CA(true)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	caPEM, _ := ioutil.ReadFile(filepath.Join(dir, CACertFile))
+	os.Remove(filepath.Join(dir, CAKeyFile))
+	if err := GenCert(log.NewLogger(), OutDir(dir), CA(true)); err == nil {
+		t.Error("Expected an error without the CA key")
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(dir, CACertFile)); string(got) != string(caPEM) {
+		t.Error("Expected the CA certificate to be kept")
+	}
+
+	if err := GenCert(log.NewLogger(), KeyType("dsa"), OutDir(os.TempDir())); err == nil {
+		t.Error("Expected an error for an unknown key type")
+	}
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipherSuites are the configurable cipher suites. The TLS 1.3 cipher suites are always enabled.
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":                  tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":                  tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":               tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":               tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+// TLSVersion returns the TLS version for "1.0", "1.1", "1.2" or "1.3". An empty name returns 0, the default of
+// crypto/tls.
+func TLSVersion(name string) (uint16, error) {
+	if name == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown tls version %q, must be one of 1.0, 1.1, 1.2 or 1.3", name)
+	}
+	return v, nil
+}
+
+// CipherSuites returns the cipher suites with the given IANA names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. No
+// names return nil, the defaults of crypto/tls.
+func CipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := cipherSuites[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q, must be one of %s", name, strings.Join(cipherSuiteNames(), ", "))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func cipherSuiteNames() []string {
+	names := make([]string, 0, len(cipherSuites))
+	for name := range cipherSuites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
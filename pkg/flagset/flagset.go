@@ -1,6 +1,8 @@
 package flagset
 
 import (
+	"time"
+
 	"github.com/micro/cli/v2"
 	"github.com/owncloud/ocis-proxy/pkg/config"
 )
@@ -157,6 +159,87 @@ func ServerWithConfig(cfg *config.Config) []cli.Flag {
 			EnvVars:     []string{"PROXY_TRANSPORT_TLS_KEY"},
 			Destination: &cfg.HTTP.TLSKey,
 		},
+		&cli.StringFlag{
+			Name:        "transport-tls-cert-dir",
+			Value:       "",
+			Usage:       "Directory with <name>.crt and <name>.key pairs, the certificate is chosen by the requested server name",
+			EnvVars:     []string{"PROXY_TRANSPORT_TLS_CERT_DIR"},
+			Destination: &cfg.HTTP.TLSCertDir,
+		},
+		&cli.DurationFlag{
+			Name:        "transport-tls-reload-interval",
+			Value:       time.Minute,
+			Usage:       "How often the certificate files are checked for changes, 0 disables reloading",
+			EnvVars:     []string{"PROXY_TRANSPORT_TLS_RELOAD_INTERVAL"},
+			Destination: &cfg.HTTP.TLSReloadInterval,
+		},
+		&cli.StringFlag{
+			Name:        "tls-min-version",
+			Value:       "1.2",
+			Usage:       "Minimum TLS version, one of 1.0, 1.1, 1.2 or 1.3",
+			EnvVars:     []string{"PROXY_TLS_MIN_VERSION"},
+			Destination: &cfg.HTTP.TLSMinVersion,
+		},
+		&cli.StringSliceFlag{
+			Name:    "tls-cipher-suite",
+			Usage:   "--tls-cipher-suite TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 [--tls-cipher-suite TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256]",
+			EnvVars: []string{"PROXY_TLS_CIPHER_SUITES"},
+		},
+		&cli.BoolFlag{
+			Name:        "client-cert-auth",
+			Usage:       "Authenticate requests with TLS client certificates, the paths are configured in the config file",
+			EnvVars:     []string{"PROXY_CLIENT_CERT_AUTH"},
+			Destination: &cfg.ClientCertAuth.Enabled,
+		},
+		&cli.StringFlag{
+			Name:        "client-cert-ca",
+			Value:       "",
+			Usage:       "CA bundle to verify the TLS client certificates against",
+			EnvVars:     []string{"PROXY_CLIENT_CERT_CA"},
+			Destination: &cfg.ClientCertAuth.CA,
+		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxy",
+			Usage:   "--trusted-proxy 10.0.0.0/8 [--trusted-proxy 192.168.1.1], only their Forwarded and X-Forwarded-* headers are honoured",
+			EnvVars: []string{"PROXY_TRUSTED_PROXIES"},
+		},
+		&cli.BoolFlag{
+			Name:        "https-redirect-plaintext",
+			Usage:       "Also redirect plain http connections made directly to the proxy to https",
+			EnvVars:     []string{"PROXY_HTTPS_REDIRECT_PLAINTEXT"},
+			Destination: &cfg.HTTPSRedirect.Plaintext,
+		},
+		&cli.StringSliceFlag{
+			Name:    "https-redirect-host",
+			Usage:   "--https-redirect-host cloud.example.com [--https-redirect-host files.example.com], other hosts are redirected to the first one",
+			EnvVars: []string{"PROXY_HTTPS_REDIRECT_HOSTS"},
+		},
+		&cli.IntFlag{
+			Name:        "https-redirect-port",
+			Value:       0,
+			Usage:       "Port of the https redirect target, 0 and 443 are omitted",
+			EnvVars:     []string{"PROXY_HTTPS_REDIRECT_PORT"},
+			Destination: &cfg.HTTPSRedirect.Port,
+		},
+		&cli.DurationFlag{
+			Name:        "hsts-max-age",
+			Value:       0,
+			Usage:       "Send a Strict-Transport-Security header with this max-age on https requests, 0 sends none",
+			EnvVars:     []string{"PROXY_HSTS_MAX_AGE"},
+			Destination: &cfg.HTTPSRedirect.HSTS.MaxAge,
+		},
+		&cli.BoolFlag{
+			Name:        "hsts-include-subdomains",
+			Usage:       "Include subdomains in the Strict-Transport-Security header",
+			EnvVars:     []string{"PROXY_HSTS_INCLUDE_SUBDOMAINS"},
+			Destination: &cfg.HTTPSRedirect.HSTS.IncludeSubdomains,
+		},
+		&cli.BoolFlag{
+			Name:        "hsts-preload",
+			Usage:       "Allow the domain to be preloaded by browsers, needs a max-age of at least one year and subdomains",
+			EnvVars:     []string{"PROXY_HSTS_PRELOAD"},
+			Destination: &cfg.HTTPSRedirect.HSTS.Preload,
+		},
 		&cli.BoolFlag{
 			Name:        "tls",
 			Usage:       "Use TLS (disable only if proxy is behind a TLS-terminating reverse-proxy).",
@@ -164,6 +247,78 @@ func ServerWithConfig(cfg *config.Config) []cli.Flag {
 			Value:       true,
 			Destination: &cfg.HTTP.TLS,
 		},
+		&cli.BoolFlag{
+			Name:        "http2",
+			Value:       true,
+			Usage:       "Offer HTTP/2 on TLS connections",
+			EnvVars:     []string{"PROXY_HTTP2"},
+			Destination: &cfg.HTTP.HTTP2,
+		},
+		&cli.BoolFlag{
+			Name:        "h2c",
+			Usage:       "Serve HTTP/2 without TLS (h2c), only used with --tls=false",
+			EnvVars:     []string{"PROXY_H2C"},
+			Destination: &cfg.HTTP.H2C,
+		},
+		&cli.BoolFlag{
+			Name:        "http3",
+			Usage:       "Serve HTTP/3 (QUIC) on the UDP port of --http-addr, only used with --tls",
+			EnvVars:     []string{"PROXY_HTTP3"},
+			Destination: &cfg.HTTP.HTTP3,
+		},
+		&cli.BoolFlag{
+			Name:        "acme",
+			Usage:       "Obtain and renew the TLS certificates automatically from an ACME certificate authority",
+			EnvVars:     []string{"PROXY_ACME"},
+			Destination: &cfg.HTTP.ACME.Enabled,
+		},
+		&cli.StringSliceFlag{
+			Name:    "acme-domain",
+			Usage:   "--acme-domain cloud.example.com [--acme-domain files.example.com]",
+			EnvVars: []string{"PROXY_ACME_DOMAINS"},
+		},
+		&cli.StringFlag{
+			Name:        "acme-email",
+			Value:       "",
+			Usage:       "Contact email address for the ACME account",
+			EnvVars:     []string{"PROXY_ACME_EMAIL"},
+			Destination: &cfg.HTTP.ACME.Email,
+		},
+		&cli.StringFlag{
+			Name:        "acme-directory-url",
+			Value:       "https://acme-v02.api.letsencrypt.org/directory",
+			Usage:       "Directory URL of the ACME certificate authority",
+			EnvVars:     []string{"PROXY_ACME_DIRECTORY_URL"},
+			Destination: &cfg.HTTP.ACME.DirectoryURL,
+		},
+		&cli.StringFlag{
+			Name:        "acme-ca-cert",
+			Value:       "",
+			Usage:       "Certificate of the ACME server, only needed for local test CAs",
+			EnvVars:     []string{"PROXY_ACME_CA_CERT"},
+			Destination: &cfg.HTTP.ACME.CACert,
+		},
+		&cli.StringFlag{
+			Name:        "acme-cache-dir",
+			Value:       "acme",
+			Usage:       "Directory to store the ACME account key and certificates",
+			EnvVars:     []string{"PROXY_ACME_CACHE_DIR"},
+			Destination: &cfg.HTTP.ACME.CacheDir,
+		},
+		&cli.StringFlag{
+			Name:        "acme-http-addr",
+			Value:       "0.0.0.0:80",
+			Usage:       "Address to answer ACME HTTP-01 challenges on, empty to only use TLS-ALPN-01",
+			EnvVars:     []string{"PROXY_ACME_HTTP_ADDR"},
+			Destination: &cfg.HTTP.ACME.HTTPAddr,
+		},
+		&cli.DurationFlag{
+			Name:        "acme-renew-before",
+			Value:       30 * 24 * time.Hour,
+			Usage:       "Renew certificates this long before they expire",
+			EnvVars:     []string{"PROXY_ACME_RENEW_BEFORE"},
+			Destination: &cfg.HTTP.ACME.RenewBefore,
+		},
 		&cli.StringFlag{
 			Name:        "jwt-secret",
 			Value:       "Pive-Fumkiu4",
@@ -195,6 +350,60 @@ func ServerWithConfig(cfg *config.Config) []cli.Flag {
 			EnvVars:     []string{"PROXY_OIDC_INSECURE"},
 			Destination: &cfg.OIDC.Insecure,
 		},
+		&cli.BoolFlag{
+			Name:        "access-log-enabled",
+			Usage:       "Enable the access log",
+			EnvVars:     []string{"PROXY_ACCESS_LOG_ENABLED"},
+			Destination: &cfg.AccessLog.Enabled,
+		},
+		&cli.StringFlag{
+			Name:        "access-log-format",
+			Value:       "json",
+			Usage:       "Format of the access log: json, combined or template",
+			EnvVars:     []string{"PROXY_ACCESS_LOG_FORMAT"},
+			Destination: &cfg.AccessLog.Format,
+		},
+		&cli.StringFlag{
+			Name:        "access-log-template",
+			Value:       "",
+			Usage:       "Go template for the access log format template, e.g. '{{.Method}} {{.Path}} {{.Status}}'",
+			EnvVars:     []string{"PROXY_ACCESS_LOG_TEMPLATE"},
+			Destination: &cfg.AccessLog.Template,
+		},
+		&cli.StringFlag{
+			Name:        "access-log-output",
+			Value:       "stdout",
+			Usage:       "Write the access log to stdout or to the given file",
+			EnvVars:     []string{"PROXY_ACCESS_LOG_OUTPUT"},
+			Destination: &cfg.AccessLog.Output,
+		},
+		&cli.IntFlag{
+			Name:        "access-log-max-size",
+			Value:       100,
+			Usage:       "Maximum size in megabytes of the access log file before it gets rotated",
+			EnvVars:     []string{"PROXY_ACCESS_LOG_MAX_SIZE"},
+			Destination: &cfg.AccessLog.MaxSize,
+		},
+		&cli.IntFlag{
+			Name:        "access-log-max-backups",
+			Value:       10,
+			Usage:       "Maximum number of rotated access log files to retain",
+			EnvVars:     []string{"PROXY_ACCESS_LOG_MAX_BACKUPS"},
+			Destination: &cfg.AccessLog.MaxBackups,
+		},
+		&cli.IntFlag{
+			Name:        "access-log-max-age",
+			Value:       28,
+			Usage:       "Maximum number of days to retain rotated access log files",
+			EnvVars:     []string{"PROXY_ACCESS_LOG_MAX_AGE"},
+			Destination: &cfg.AccessLog.MaxAge,
+		},
+		&cli.StringSliceFlag{
+			Name:    "access-log-exclude",
+			Value:   cli.NewStringSlice("/healthz", "/status.php"),
+			Usage:   "--access-log-exclude /healthz [--access-log-exclude /status.php]",
+			EnvVars: []string{"PROXY_ACCESS_LOG_EXCLUDE"},
+		},
 		&cli.StringSliceFlag{
 			Name:    "presignedurl-allow-method",
 			Value:   cli.NewStringSlice("GET"),
@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -12,11 +15,20 @@ var (
 	Subsystem = "proxy"
 )
 
+// requestLabels are the labels of the per request metrics.
+var requestLabels = []string{"policy", "route", "backend", "method", "status"}
+
 // Metrics defines the available metrics of this service.
 type Metrics struct {
-	Counter  *prometheus.CounterVec
-	Latency  *prometheus.SummaryVec
-	Duration *prometheus.HistogramVec
+	Counter        *prometheus.CounterVec
+	Latency        *prometheus.SummaryVec
+	Duration       *prometheus.HistogramVec
+	InFlight       prometheus.Gauge
+	UpstreamErrors *prometheus.CounterVec
+	AuthOutcomes   *prometheus.CounterVec
+	BytesIn        *prometheus.CounterVec
+	BytesOut       *prometheus.CounterVec
+	Selections     *prometheus.CounterVec
 }
 
 // New initializes the available metrics.
@@ -27,19 +39,55 @@ func New() *Metrics {
 			Subsystem: Subsystem,
 			Name:      "proxy_total",
 			Help:      "How many proxy requests processed",
-		}, []string{}),
+		}, requestLabels),
 		Latency: prometheus.NewSummaryVec(prometheus.SummaryOpts{
 			Namespace: Namespace,
 			Subsystem: Subsystem,
 			Name:      "proxy_latency_microseconds",
 			Help:      "proxy request latencies in microseconds",
-		}, []string{}),
+		}, requestLabels),
 		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: Namespace,
 			Subsystem: Subsystem,
 			Name:      "proxy_duration_seconds",
 			Help:      "proxy method request time in seconds",
-		}, []string{}),
+		}, requestLabels),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "proxy_in_flight_requests",
+			Help:      "How many proxy requests are currently processed",
+		}),
+		UpstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "upstream_errors_total",
+			Help:      "How many requests failed because of an error of the backend",
+		}, []string{"policy", "backend", "status"}),
+		AuthOutcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "auth_total",
+			Help:      "Outcomes of the authentication methods",
+		}, []string{"method", "outcome"}),
+		BytesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "request_bytes_total",
+			Help:      "How many bytes were received from clients",
+		}, []string{"policy"}),
+		BytesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "response_bytes_total",
+			Help:      "How many bytes were sent to clients",
+		}, []string{"policy"}),
+		Selections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "policy_selections_total",
+			Help:      "How many requests were assigned to a policy by a policy-selector",
+		}, []string{"selector", "policy"}),
 	}
 
 	prometheus.Register(
@@ -54,5 +102,82 @@ func New() *Metrics {
 		m.Duration,
 	)
 
+	prometheus.Register(
+		m.InFlight,
+	)
+
+	prometheus.Register(
+		m.UpstreamErrors,
+	)
+
+	prometheus.Register(
+		m.AuthOutcomes,
+	)
+
+	prometheus.Register(
+		m.BytesIn,
+	)
+
+	prometheus.Register(
+		m.BytesOut,
+	)
+
+	prometheus.Register(
+		m.Selections,
+	)
+
 	return m
 }
+
+// Request records a finished proxy request. It is a noop if m is nil.
+func (m *Metrics) Request(policy, route, backend, method string, status int, d time.Duration, bytesIn, bytesOut int64) {
+	if m == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"policy":  policy,
+		"route":   route,
+		"backend": backend,
+		"method":  method,
+		"status":  StatusClass(status),
+	}
+
+	m.Counter.With(labels).Inc()
+	m.Latency.With(labels).Observe(float64(d.Microseconds()))
+	m.Duration.With(labels).Observe(d.Seconds())
+	m.BytesIn.WithLabelValues(policy).Add(float64(bytesIn))
+	m.BytesOut.WithLabelValues(policy).Add(float64(bytesOut))
+}
+
+// UpstreamError records a request which failed because of the backend. It is a noop if m is nil.
+func (m *Metrics) UpstreamError(policy, backend string, status int) {
+	if m == nil {
+		return
+	}
+
+	m.UpstreamErrors.WithLabelValues(policy, backend, strconv.Itoa(status)).Inc()
+}
+
+// AuthOutcome records the outcome of an authentication method, e.g. oidc success. It is a noop if m is nil.
+func (m *Metrics) AuthOutcome(method, outcome string) {
+	if m == nil {
+		return
+	}
+
+	m.AuthOutcomes.WithLabelValues(method, outcome).Inc()
+}
+
+// PolicySelected records that a policy-selector assigned a request to a policy. It is a noop if m is nil.
+func (m *Metrics) PolicySelected(selector, policy string) {
+	if m == nil {
+		return
+	}
+
+	m.Selections.WithLabelValues(selector, policy).Inc()
+}
+
+// StatusClass returns the class of a http status code, e.g. "2xx".
+func StatusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// AccessLogFormatJSON writes one json object per request
+	AccessLogFormatJSON = "json"
+	// AccessLogFormatCombined writes the Apache combined log format
+	AccessLogFormatCombined = "combined"
+	// AccessLogFormatTemplate writes the configured text/template
+	AccessLogFormatTemplate = "template"
+)
+
+// AccessLogEntry is a single entry of the access log. Its fields can be used in access log templates.
+type AccessLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	Proto      string
+	Method     string
+	Path       string
+	Query      string
+	Status     int
+	Bytes      int
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+	RequestID  string
+	Policy     string
+	RouteType  string
+	Endpoint   string
+	Backend    string
+	UserID     string
+}
+
+// AccessLog provides a middleware which writes an access log entry for every request.
+func AccessLog(opts ...Option) func(next http.Handler) http.Handler {
+	opt := newOptions(opts...)
+	cfg := opt.AccessLogConfig
+
+	write, err := accessLogWriter(cfg, opt.AccessLogWriter)
+	if err != nil {
+		opt.Logger.Fatal().Err(err).Msg("Could not initialize access log")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !shouldLog(cfg, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			ctx, info := request.EnsureInfo(r.Context())
+			ww := newResponseRecorder(w)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			write(AccessLogEntry{
+				Time:       start,
+				RemoteAddr: request.ForwardedFrom(r).For,
+				Proto:      r.Proto,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Query:      r.URL.RawQuery,
+				Status:     ww.Status(),
+				Bytes:      ww.BytesWritten(),
+				Duration:   time.Since(start),
+				Referer:    r.Referer(),
+				UserAgent:  r.UserAgent(),
+				RequestID:  request.IDFromContext(ctx),
+				Policy:     info.Policy,
+				RouteType:  info.RouteType,
+				Endpoint:   info.Endpoint,
+				Backend:    info.Backend,
+				UserID:     info.UserID,
+			})
+		})
+	}
+}
+
+// shouldLog decides based on the exclusions and the sampling rules if a request to path is logged.
+func shouldLog(cfg config.AccessLog, path string) bool {
+	for _, prefix := range cfg.Exclude {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+
+	for _, s := range cfg.Sampling {
+		if strings.HasPrefix(path, s.Prefix) {
+			return rand.Float64() < s.Rate
+		}
+	}
+
+	return true
+}
+
+// accessLogWriter returns a function which formats an entry according to the configured format and writes it to w.
+func accessLogWriter(cfg config.AccessLog, w io.Writer) (func(AccessLogEntry), error) {
+	// entries are written concurrently, make sure lines don't interleave
+	var mu sync.Mutex
+
+	switch cfg.Format {
+	case AccessLogFormatJSON, "":
+		logger := zerolog.New(w)
+		return func(e AccessLogEntry) {
+			logger.Log().
+				Time("time", e.Time).
+				Str("remote_addr", e.RemoteAddr).
+				Str("proto", e.Proto).
+				Str("method", e.Method).
+				Str("path", e.Path).
+				Int("status", e.Status).
+				Int("bytes", e.Bytes).
+				Dur("duration", e.Duration).
+				Str("request_id", e.RequestID).
+				Str("policy", e.Policy).
+				Str("route_type", e.RouteType).
+				Str("endpoint", e.Endpoint).
+				Str("backend", e.Backend).
+				Str("user_id", e.UserID).
+				Msg("")
+		}, nil
+	case AccessLogFormatCombined:
+		return func(e AccessLogEntry) {
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = io.WriteString(w, combinedLogLine(e))
+		}, nil
+	case AccessLogFormatTemplate:
+		tpl, err := template.New("access_log").Parse(strings.TrimSuffix(cfg.Template, "\n") + "\n")
+		if err != nil {
+			return nil, fmt.Errorf("invalid access log template: %w", err)
+		}
+		return func(e AccessLogEntry) {
+			mu.Lock()
+			defer mu.Unlock()
+			_ = tpl.Execute(w, e)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", cfg.Format)
+	}
+}
+
+// combinedLogLine formats e in the Apache combined log format.
+func combinedLogLine(e AccessLogEntry) string {
+	uri := e.Path
+	if e.Query != "" {
+		uri += "?" + e.Query
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %q %q\n",
+		e.RemoteAddr,
+		dashIfEmpty(e.UserID),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method,
+		uri,
+		e.Proto,
+		e.Status,
+		e.Bytes,
+		dashIfEmpty(e.Referer),
+		dashIfEmpty(e.UserAgent),
+	)
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/owncloud/ocis-pkg/v2/log"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+func TestAccessLogJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := request.InfoFromContext(r.Context())
+		info.Policy = "reva"
+		info.Backend = "http://localhost:9140"
+		info.UserID = "4c510ada-c86b-4815-8820-42cdf82c3d51"
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	})
+
+	m := AccessLog(
+		Logger(log.NewLogger()),
+		AccessLogConfig(config.AccessLog{Format: AccessLogFormatJSON}),
+		AccessLogWriter(buf),
+	)(next)
+
+	r := httptest.NewRequest(http.MethodPut, "https://example.com/remote.php/webdav/file.txt", nil)
+	m.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a json access log entry got %s", buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"method":  "PUT",
+		"path":    "/remote.php/webdav/file.txt",
+		"status":  float64(http.StatusCreated),
+		"bytes":   float64(len("created")),
+		"policy":  "reva",
+		"backend": "http://localhost:9140",
+		"user_id": "4c510ada-c86b-4815-8820-42cdf82c3d51",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("expected %s to be %v got %v", k, v, entry[k])
+		}
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	buf := &bytes.Buffer{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	})
+
+	m := AccessLog(
+		Logger(log.NewLogger()),
+		AccessLogConfig(config.AccessLog{Format: AccessLogFormatCombined}),
+		AccessLogWriter(buf),
+	)(next)
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/status.php?foo=bar", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	m.ServeHTTP(httptest.NewRecorder(), r)
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") {
+		t.Errorf("unexpected start of combined log line %s", line)
+	}
+
+	if !strings.HasSuffix(line, `"GET /status.php?foo=bar HTTP/1.1" 200 2 "-" "test-agent"`+"\n") {
+		t.Errorf("unexpected end of combined log line %s", line)
+	}
+}
+
+func TestAccessLogTemplate(t *testing.T) {
+	buf := &bytes.Buffer{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	m := AccessLog(
+		Logger(log.NewLogger()),
+		AccessLogConfig(config.AccessLog{Format: AccessLogFormatTemplate, Template: "{{.Method}} {{.Path}} {{.Status}}"}),
+		AccessLogWriter(buf),
+	)(next)
+
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil))
+
+	if got, want := buf.String(), "GET /foo 200\n"; got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+}
+
+func TestShouldLog(t *testing.T) {
+	cfg := config.AccessLog{
+		Exclude: []string{"/healthz"},
+		Sampling: []config.AccessLogSampling{
+			{Prefix: "/never", Rate: 0},
+			{Prefix: "/always", Rate: 1},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/healthz", false},
+		{"/never/foo", false},
+		{"/always/foo", true},
+		{"/other", true},
+	}
+
+	for _, tt := range tests {
+		if got := shouldLog(cfg, tt.path); got != tt.expected {
+			t.Errorf("with %s expected %t got %t", tt.path, tt.expected, got)
+		}
+	}
+}
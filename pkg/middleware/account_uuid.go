@@ -14,11 +14,14 @@ import (
 	acc "github.com/owncloud/ocis-accounts/pkg/proto/v0"
 	"github.com/owncloud/ocis-pkg/v2/log"
 	"github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+	"github.com/owncloud/ocis-proxy/pkg/request"
 	settings "github.com/owncloud/ocis-settings/pkg/proto/v0"
+	"go.opencensus.io/trace"
 )
 
-func getAccount(l log.Logger, ac acc.AccountsService, query string) (account *acc.Account, status int) {
-	resp, err := ac.ListAccounts(context.Background(), &acc.ListAccountsRequest{
+func getAccount(ctx context.Context, l log.Logger, ac acc.AccountsService, query string) (account *acc.Account, status int) {
+	resp, err := ac.ListAccounts(ctx, &acc.ListAccountsRequest{
 		Query:    query,
 		PageSize: 2,
 	})
@@ -45,7 +48,7 @@ func getAccount(l log.Logger, ac acc.AccountsService, query string) (account *ac
 	return
 }
 
-func createAccount(l log.Logger, claims *oidc.StandardClaims, ac acc.AccountsService) (*acc.Account, int) {
+func createAccount(ctx context.Context, l log.Logger, claims *oidc.StandardClaims, ac acc.AccountsService) (*acc.Account, int) {
 	// TODO check if fields are missing.
 	req := &acc.CreateAccountRequest{
 		Account: &acc.Account{
@@ -58,7 +61,7 @@ func createAccount(l log.Logger, claims *oidc.StandardClaims, ac acc.AccountsSer
 			// TODO assign uidnumber and gidnumber? better do that in ocis-accounts as it can keep track of the next numbers
 		},
 	}
-	created, err := ac.CreateAccount(context.Background(), req)
+	created, err := ac.CreateAccount(ctx, req)
 	if err != nil {
 		l.Error().Err(err).Interface("account", req.Account).Msg("could not create account")
 		return nil, http.StatusInternalServerError
@@ -83,33 +86,44 @@ func AccountUUID(opts ...Option) func(next http.Handler) http.Handler {
 		}
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			l := opt.Logger
+			l := request.Logger(r.Context(), opt.Logger)
 			claims := oidc.FromContext(r.Context())
 			if claims == nil {
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			lookupCtx, lookupSpan := trace.StartSpan(r.Context(), "proxy.accounts.lookup")
 			var account *acc.Account
 			var status int
 			if claims.Email != "" {
-				account, status = getAccount(l, opt.AccountsClient, fmt.Sprintf("mail eq '%s'", strings.ReplaceAll(claims.Email, "'", "''")))
+				account, status = getAccount(lookupCtx, l, opt.AccountsClient, fmt.Sprintf("mail eq '%s'", strings.ReplaceAll(claims.Email, "'", "''")))
 			} else if claims.PreferredUsername != "" {
-				account, status = getAccount(l, opt.AccountsClient, fmt.Sprintf("preferred_name eq '%s'", strings.ReplaceAll(claims.PreferredUsername, "'", "''")))
+				account, status = getAccount(lookupCtx, l, opt.AccountsClient, fmt.Sprintf("preferred_name eq '%s'", strings.ReplaceAll(claims.PreferredUsername, "'", "''")))
 			} else if claims.OcisID != "" {
-				account, status = getAccount(l, opt.AccountsClient, fmt.Sprintf("id eq '%s'", strings.ReplaceAll(claims.OcisID, "'", "''")))
+				account, status = getAccount(lookupCtx, l, opt.AccountsClient, fmt.Sprintf("id eq '%s'", strings.ReplaceAll(claims.OcisID, "'", "''")))
 			} else {
 				// TODO allow lookup by custom claim, eg an id ... or sub
 				l.Error().Err(err).Msgf("Could not lookup account, no mail or preferred_username claim set")
 				w.WriteHeader(http.StatusInternalServerError)
 			}
+			lookupSpan.End()
 			if status != 0 || account == nil {
+				if status == http.StatusNotFound && !provision(r, opt.NoProvisioningPolicies) {
+					// e.g. users who have not been migrated yet, creating the account would migrate them
+					l.Debug().Interface("claims", claims).Msg("Account not found, not provisioning it for the policy")
+					next.ServeHTTP(w, r)
+					return
+				}
 				if status == http.StatusNotFound {
-					account, status = createAccount(l, claims, opt.AccountsClient)
+					createCtx, createSpan := trace.StartSpan(r.Context(), "proxy.accounts.create")
+					account, status = createAccount(createCtx, l, claims, opt.AccountsClient)
+					createSpan.End()
 					if status != 0 {
 						w.WriteHeader(status)
 						return
 					}
+					opt.Metrics.AuthOutcome("account", "provisioned")
 				} else {
 					w.WriteHeader(status)
 					return
@@ -128,7 +142,9 @@ func AccountUUID(opts ...Option) func(next http.Handler) http.Handler {
 			}
 
 			// fetch active roles from ocis-settings
-			assignmentResponse, err := opt.SettingsRoleService.ListRoleAssignments(r.Context(), &settings.ListRoleAssignmentsRequest{AccountUuid: account.Id})
+			rolesCtx, rolesSpan := trace.StartSpan(r.Context(), "proxy.settings.roles")
+			assignmentResponse, err := opt.SettingsRoleService.ListRoleAssignments(rolesCtx, &settings.ListRoleAssignmentsRequest{AccountUuid: account.Id})
+			rolesSpan.End()
 			roleIDs := make([]string, 0)
 			if err != nil {
 				l.Err(err).Str("accountID", account.Id).Msg("failed to fetch role assignments")
@@ -174,7 +190,9 @@ func AccountUUID(opts ...Option) func(next http.Handler) http.Handler {
 				}
 			}
 
-			token, err := tokenManager.MintToken(r.Context(), user)
+			mintCtx, mintSpan := trace.StartSpan(r.Context(), "proxy.token.mint")
+			token, err := tokenManager.MintToken(mintCtx, user)
+			mintSpan.End()
 
 			if err != nil {
 				l.Error().Err(err).Msgf("Could not mint token")
@@ -182,8 +200,26 @@ func AccountUUID(opts ...Option) func(next http.Handler) http.Handler {
 				return
 			}
 
+			if info := request.InfoFromContext(r.Context()); info != nil {
+				info.UserID = account.Id
+			}
+
 			r.Header.Set("x-access-token", token)
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// provision reports whether unknown accounts are created for the policy selected for the request.
+func provision(r *http.Request, noProvisioning []string) bool {
+	pol, ok := policy.FromContext(r.Context())
+	if !ok {
+		return true
+	}
+	for _, p := range noProvisioning {
+		if p == pol {
+			return false
+		}
+	}
+	return true
+}
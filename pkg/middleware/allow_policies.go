@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+	"github.com/owncloud/ocis-proxy/pkg/render"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// AllowPolicies provides a middleware which rejects requests whose policy is not one of the allowed policies, e.g.
+// of a listener. It must run after SelectPolicy. No allowed policies allow all policies.
+func AllowPolicies(opts ...Option) func(next http.Handler) http.Handler {
+	opt := newOptions(opts...)
+
+	allowed := make(map[string]bool, len(opt.AllowedPolicies))
+	for _, p := range opt.AllowedPolicies {
+		allowed[p] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(allowed) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if pol, _ := policy.FromContext(r.Context()); !allowed[pol] {
+				l := request.Logger(r.Context(), opt.Logger)
+				l.Debug().Str("policy", pol).Str("path", r.URL.Path).Msg("policy is not allowed")
+				render.Error(w, r, http.StatusForbidden, "policy not allowed")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
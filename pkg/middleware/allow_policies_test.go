@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/owncloud/ocis-pkg/v2/log"
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+)
+
+func TestAllowPolicies(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		allowed []string
+		policy  string
+		status  int
+	}{
+		{allowed: nil, policy: "oc10", status: http.StatusOK},
+		{allowed: []string{"reva"}, policy: "reva", status: http.StatusOK},
+		{allowed: []string{"reva"}, policy: "oc10", status: http.StatusForbidden},
+		{allowed: []string{"reva"}, policy: "", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		m := AllowPolicies(Logger(log.NewLogger()), AllowedPolicies(tt.allowed))(next)
+
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:9200/", nil)
+		if tt.policy != "" {
+			r = r.WithContext(policy.NewContext(r.Context(), tt.policy))
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("allowed %v, policy %q: expected status %d got %d", tt.allowed, tt.policy, tt.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	ocisoidc "github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// ClientCertAuth provides a middleware which authenticates requests with the TLS client certificate. The certificate
+// has already been verified against the configured CAs in the TLS handshake. The claims mapped from the certificate
+// are stored in the context like the ones of the OpenIDConnect middleware, so the account is resolved and the reva
+// token minted by AccountUUID. Only requests to the configured path prefixes are authenticated, the longest prefix
+// wins.
+func ClientCertAuth(opts ...Option) func(next http.Handler) http.Handler {
+	opt := newOptions(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := clientCertPath(opt.ClientCertAuthConfig.Paths, r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			l := request.Logger(r.Context(), opt.Logger)
+
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				if p.Required {
+					opt.Metrics.AuthOutcome("client_cert", "failure")
+					http.Error(w, "a valid client certificate is required", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, ok := certClaims(r.TLS.VerifiedChains[0][0], p.Username)
+			if !ok {
+				l.Error().
+					Str("subject", r.TLS.VerifiedChains[0][0].Subject.String()).
+					Str("field", p.Username).
+					Msg("client certificate has no username")
+				opt.Metrics.AuthOutcome("client_cert", "failure")
+				http.Error(w, "the client certificate has no username", http.StatusUnauthorized)
+				return
+			}
+
+			opt.Metrics.AuthOutcome("client_cert", "success")
+			l.Debug().Interface("claims", claims).Msg("authenticated with client certificate")
+
+			next.ServeHTTP(w, r.WithContext(ocisoidc.NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// clientCertPath returns the configuration of the longest prefix matching the path.
+func clientCertPath(paths []config.ClientCertPath, path string) (config.ClientCertPath, bool) {
+	var match config.ClientCertPath
+	found := false
+	for _, p := range paths {
+		if strings.HasPrefix(path, p.Prefix) && (!found || len(p.Prefix) > len(match.Prefix)) {
+			match, found = p, true
+		}
+	}
+	return match, found
+}
+
+// certClaims maps the subject and the subject alternative names of a certificate to claims.
+func certClaims(cert *x509.Certificate, field string) (*ocisoidc.StandardClaims, bool) {
+	var username string
+	switch field {
+	case "", config.CertFieldCN:
+		username = cert.Subject.CommonName
+	case config.CertFieldEmail:
+		if len(cert.EmailAddresses) > 0 {
+			username = cert.EmailAddresses[0]
+		}
+	case config.CertFieldDNS:
+		if len(cert.DNSNames) > 0 {
+			username = cert.DNSNames[0]
+		}
+	case config.CertFieldURI:
+		if len(cert.URIs) > 0 {
+			username = cert.URIs[0].String()
+		}
+	}
+	if username == "" {
+		return nil, false
+	}
+
+	claims := &ocisoidc.StandardClaims{
+		Iss:               cert.Issuer.String(),
+		Sub:               cert.Subject.String(),
+		PreferredUsername: username,
+		DisplayName:       cert.Subject.CommonName,
+	}
+	if len(cert.EmailAddresses) > 0 {
+		claims.Email = cert.EmailAddresses[0]
+	}
+	if claims.DisplayName == "" {
+		claims.DisplayName = username
+	}
+	return claims, true
+}
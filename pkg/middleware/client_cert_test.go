@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/owncloud/ocis-pkg/v2/log"
+	ocisoidc "github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+)
+
+func TestClientCertAuth(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "kiosk-1"},
+		Issuer:         pkix.Name{CommonName: "Devices CA"},
+		EmailAddresses: []string{"kiosk-1@example.com"},
+	}
+
+	var claims *ocisoidc.StandardClaims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = ocisoidc.FromContext(r.Context())
+	})
+
+	m := ClientCertAuth(
+		Logger(log.NewLogger()),
+		ClientCertAuthConfig(config.ClientCertAuth{
+			Enabled: true,
+			Paths: []config.ClientCertPath{
+				{Prefix: "/remote.php/", Required: false},
+				{Prefix: "/remote.php/dav/kiosk/", Required: true, Username: config.CertFieldEmail},
+				{Prefix: "/devices/", Required: true, Username: config.CertFieldDNS},
+			},
+		}),
+	)(next)
+
+	tests := []struct {
+		path     string
+		cert     *x509.Certificate
+		status   int
+		username string
+	}{
+		{path: "/ocs/v1.php", cert: cert, status: http.StatusOK},
+		{path: "/remote.php/webdav", cert: cert, status: http.StatusOK, username: "kiosk-1"},
+		{path: "/remote.php/webdav", status: http.StatusOK},
+		{path: "/remote.php/dav/kiosk/files", cert: cert, status: http.StatusOK, username: "kiosk-1@example.com"},
+		{path: "/remote.php/dav/kiosk/files", status: http.StatusUnauthorized},
+		{path: "/devices/1", cert: cert, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		claims = nil
+		r := httptest.NewRequest(http.MethodGet, "https://cloud.example.com"+tt.path, nil)
+		if tt.cert != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d got %d", tt.path, tt.status, w.Code)
+		}
+
+		switch {
+		case tt.username == "" && claims != nil:
+			t.Errorf("%s: expected no claims got %+v", tt.path, claims)
+		case tt.username != "" && claims == nil:
+			t.Errorf("%s: expected claims for %s", tt.path, tt.username)
+		case tt.username != "":
+			if claims.PreferredUsername != tt.username || claims.Email != "kiosk-1@example.com" || claims.Iss != "CN=Devices CA" {
+				t.Errorf("%s: unexpected claims %+v", tt.path, claims)
+			}
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/cs3org/reva/pkg/token/manager/jwt"
 	"github.com/micro/go-micro/v2/errors"
 	"github.com/owncloud/ocis-accounts/pkg/proto/v0"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"go.opencensus.io/trace"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -19,13 +21,14 @@ func CreateHome(opts ...Option) func(next http.Handler) http.Handler {
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := request.Logger(r.Context(), opt.Logger)
 			accounts := opt.AccountsClient
 
 			tokenManager, err := jwt.New(map[string]interface{}{
 				"secret": opt.TokenManagerConfig.JWTSecret,
 			})
 			if err != nil {
-				opt.Logger.Error().Err(err).Msg("error creating a token manager")
+				l.Error().Err(err).Msg("error creating a token manager")
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -38,7 +41,7 @@ func CreateHome(opts ...Option) func(next http.Handler) http.Handler {
 
 			user, err := tokenManager.DismantleToken(r.Context(), token)
 			if err != nil {
-				opt.Logger.Err(err).Msg("error getting user from access token")
+				l.Err(err).Msg("error getting user from access token")
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -48,27 +51,29 @@ func CreateHome(opts ...Option) func(next http.Handler) http.Handler {
 			if err != nil {
 				e := errors.Parse(err.Error())
 				if e.Code == http.StatusNotFound {
-					opt.Logger.Debug().Msgf("account with id %s not found", user.Id.OpaqueId)
+					l.Debug().Msgf("account with id %s not found", user.Id.OpaqueId)
 					next.ServeHTTP(w, r)
 					return
 				}
-				opt.Logger.Err(err).Msgf("error getting user with id %s from accounts service", user.Id.OpaqueId)
+				l.Err(err).Msgf("error getting user with id %s from accounts service", user.Id.OpaqueId)
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
+			ctx, span := trace.StartSpan(r.Context(), "proxy.reva.createhome")
 			// we need to pass the token to authenticate the CreateHome request.
 			//ctx := tokenpkg.ContextSetToken(r.Context(), token)
-			ctx := metadata.AppendToOutgoingContext(r.Context(), tokenpkg.TokenHeader, token)
+			ctx = metadata.AppendToOutgoingContext(ctx, tokenpkg.TokenHeader, token)
 
 			createHomeReq := &provider.CreateHomeRequest{}
 			createHomeRes, err := opt.RevaGatewayClient.CreateHome(ctx, createHomeReq)
+			span.End()
 
 			if err != nil {
-				opt.Logger.Err(err).Msg("error calling CreateHome")
+				l.Err(err).Msg("error calling CreateHome")
 			} else if createHomeRes.Status.Code != rpc.Code_CODE_OK {
 				err := status.NewErrorFromCode(createHomeRes.Status.Code, "gateway")
-				opt.Logger.Err(err).Msg("error when calling Createhome")
+				l.Err(err).Msg("error when calling Createhome")
 			}
 
 			next.ServeHTTP(w, r)
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// Forwarded provides a middleware which resolves the client side of a request, see request.Forwarded. The
+// Forwarded and X-Forwarded-* headers are only honoured if the request comes from one of the trusted proxies.
+// Later middlewares and the proxy use request.ForwardedFrom instead of the headers.
+func Forwarded(opts ...Option) func(next http.Handler) http.Handler {
+	opt := newOptions(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f := opt.TrustedProxies.Resolve(r)
+			next.ServeHTTP(w, r.WithContext(request.NewForwardedContext(r.Context(), f)))
+		})
+	}
+}
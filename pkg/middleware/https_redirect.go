@@ -2,18 +2,79 @@ package middleware
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/owncloud/ocis-proxy/pkg/request"
 )
 
-// RedirectToHTTPS redirects insecure requests to https
-func RedirectToHTTPS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		proto := req.Header.Get("x-forwarded-proto")
-		if proto == "http" || proto == "HTTP" {
-			http.Redirect(res, req, fmt.Sprintf("https://%s%s", req.Host, req.URL), http.StatusPermanentRedirect)
-			return
+// RedirectToHTTPS provides a middleware which redirects plain http requests to https. Requests which reached a
+// trusted proxy over http are always redirected, direct plain http connections only if configured. The redirect
+// target is limited to the configured hosts. Https requests get a Strict-Transport-Security header if configured.
+// It must run after Forwarded.
+func RedirectToHTTPS(opts ...Option) func(next http.Handler) http.Handler {
+	opt := newOptions(opts...)
+	cfg := opt.HTTPSRedirectConfig
+
+	hsts := ""
+	if cfg.HSTS.MaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int64(cfg.HSTS.MaxAge.Seconds()))
+		if cfg.HSTS.IncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTS.Preload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f := request.ForwardedFrom(r)
+
+			switch {
+			case f.Proto == "https":
+				if hsts != "" {
+					w.Header().Set("Strict-Transport-Security", hsts)
+				}
+			case f.Proxied || cfg.Plaintext:
+				target := "https://" + redirectHost(f.Host, cfg.Hosts, cfg.Port) + r.URL.RequestURI()
+				http.Redirect(w, r, target, http.StatusPermanentRedirect)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// redirectHost returns the host of the redirect target. Hosts which are not allowed are replaced by the first
+// allowed host, so the redirect can't point to arbitrary sites.
+func redirectHost(host string, allowed []string, port int) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+
+	if len(allowed) > 0 {
+		ok := false
+		for _, a := range allowed {
+			if strings.EqualFold(a, host) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			host = strings.ToLower(allowed[0])
 		}
+	}
 
-		next.ServeHTTP(res, req)
-	})
+	if port != 0 && port != 443 {
+		return net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
 }
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	trusted, _ := request.ParseTrustedProxies([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name     string
+		cfg      config.HTTPSRedirect
+		url      string
+		remote   string
+		tls      bool
+		proto    string
+		status   int
+		location string
+		hsts     string
+	}{
+		{
+			name:   "direct plain http is not redirected by default",
+			url:    "http://cloud.example.com/index.php?x=1",
+			remote: "203.0.113.1:1234",
+			status: http.StatusOK,
+		},
+		{
+			name:     "direct plain http",
+			cfg:      config.HTTPSRedirect{Plaintext: true},
+			url:      "http://cloud.example.com:9200/index.php?x=1",
+			remote:   "203.0.113.1:1234",
+			status:   http.StatusPermanentRedirect,
+			location: "https://cloud.example.com/index.php?x=1",
+		},
+		{
+			name:     "trusted proxy",
+			url:      "http://cloud.example.com/",
+			remote:   "10.0.0.1:1234",
+			proto:    "http",
+			status:   http.StatusPermanentRedirect,
+			location: "https://cloud.example.com/",
+		},
+		{
+			name:   "spoofed proto",
+			url:    "http://cloud.example.com/",
+			remote: "203.0.113.1:1234",
+			proto:  "http",
+			status: http.StatusOK,
+		},
+		{
+			name:     "host is not allowed",
+			cfg:      config.HTTPSRedirect{Plaintext: true, Hosts: []string{"cloud.example.com"}, Port: 9200},
+			url:      "http://evil.example.org/login",
+			remote:   "203.0.113.1:1234",
+			status:   http.StatusPermanentRedirect,
+			location: "https://cloud.example.com:9200/login",
+		},
+		{
+			name:   "hsts",
+			cfg:    config.HTTPSRedirect{HSTS: config.HSTS{MaxAge: 365 * 24 * time.Hour, IncludeSubdomains: true, Preload: true}},
+			url:    "https://cloud.example.com/",
+			remote: "203.0.113.1:1234",
+			tls:    true,
+			status: http.StatusOK,
+			hsts:   "max-age=31536000; includeSubDomains; preload",
+		},
+		{
+			name:   "no hsts on plain http",
+			cfg:    config.HTTPSRedirect{HSTS: config.HSTS{MaxAge: time.Hour}},
+			url:    "http://cloud.example.com/",
+			remote: "203.0.113.1:1234",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		m := Forwarded(TrustedProxies(trusted))(RedirectToHTTPS(HTTPSRedirectConfig(tt.cfg))(next))
+
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		r.RemoteAddr = tt.remote
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d got %d", tt.name, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s: expected location %q got %q", tt.name, tt.location, got)
+		}
+		if got := w.Header().Get("Strict-Transport-Security"); got != tt.hsts {
+			t.Errorf("%s: expected hsts %q got %q", tt.name, tt.hsts, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// Instrument provides a middleware which records the proxy metrics of every request.
+func Instrument(opts ...Option) func(next http.Handler) http.Handler {
+	opt := newOptions(opts...)
+	m := opt.Metrics
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			m.InFlight.Inc()
+			defer m.InFlight.Dec()
+
+			start := time.Now()
+			ctx, info := request.EnsureInfo(r.Context())
+			ww := newResponseRecorder(w)
+
+			body := &countingReader{ReadCloser: r.Body}
+			if r.Body != nil {
+				r.Body = body
+			}
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			m.Request(
+				info.Policy,
+				info.Endpoint,
+				info.Backend,
+				r.Method,
+				ww.Status(),
+				time.Since(start),
+				atomic.LoadInt64(&body.n),
+				int64(ww.BytesWritten()),
+			)
+		})
+	}
+}
+
+// countingReader counts the bytes read from the request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/owncloud/ocis-proxy/pkg/metrics"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentMiddleware(t *testing.T) {
+	m := metrics.New()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := request.InfoFromContext(r.Context())
+		info.Policy = "reva"
+		info.Endpoint = "/remote.php/"
+		info.Backend = "http://localhost:9140"
+
+		buf := make([]byte, 32)
+		for {
+			if _, err := r.Body.Read(buf); err != nil {
+				break
+			}
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("not found"))
+	})
+
+	r := httptest.NewRequest(http.MethodPut, "https://example.com/remote.php/webdav/file.txt", strings.NewReader("some content"))
+	Instrument(Metrics(m))(next).ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := testutil.ToFloat64(m.Counter.WithLabelValues("reva", "/remote.php/", "http://localhost:9140", "PUT", "4xx")); got != 1 {
+		t.Errorf("expected 1 request to be counted got %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.BytesIn.WithLabelValues("reva")); got != float64(len("some content")) {
+		t.Errorf("expected %d bytes in got %v", len("some content"), got)
+	}
+
+	if got := testutil.ToFloat64(m.BytesOut.WithLabelValues("reva")); got != float64(len("not found")) {
+		t.Errorf("expected %d bytes out got %v", len("not found"), got)
+	}
+
+	if got := testutil.ToFloat64(m.InFlight); got != 0 {
+		t.Errorf("expected no requests in flight got %v", got)
+	}
+}
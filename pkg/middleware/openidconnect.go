@@ -9,6 +9,8 @@ import (
 	"github.com/coreos/go-oidc"
 	ocisoidc "github.com/owncloud/ocis-pkg/v2/oidc"
 	"github.com/owncloud/ocis-proxy/pkg/cache"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"go.opencensus.io/trace"
 	"golang.org/x/oauth2"
 )
 
@@ -35,6 +37,7 @@ func OpenIDConnect(opts ...Option) func(next http.Handler) http.Handler {
 
 		var oidcProvider OIDCProvider
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := request.Logger(r.Context(), opt.Logger)
 			header := r.Header.Get("Authorization")
 			path := r.URL.Path
 
@@ -57,7 +60,7 @@ func OpenIDConnect(opts ...Option) func(next http.Handler) http.Handler {
 				var err error
 				oidcProvider, err = opt.OIDCProviderFunc()
 				if err != nil {
-					opt.Logger.Error().Err(err).Msg("could not initialize oidc provider")
+					l.Error().Err(err).Msg("could not initialize oidc provider")
 					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
@@ -72,19 +75,24 @@ func OpenIDConnect(opts ...Option) func(next http.Handler) http.Handler {
 
 			// The claims we want to have
 			var claims ocisoidc.StandardClaims
-			userInfo, err := oidcProvider.UserInfo(customCtx, oauth2.StaticTokenSource(oauth2Token))
+			spanCtx, span := trace.StartSpan(customCtx, "proxy.oidc.userinfo")
+			userInfo, err := oidcProvider.UserInfo(spanCtx, oauth2.StaticTokenSource(oauth2Token))
+			span.End()
 			if err != nil {
-				opt.Logger.Error().Err(err).Str("token", token).Msg("Failed to get userinfo")
+				l.Error().Err(err).Str("token", token).Msg("Failed to get userinfo")
+				opt.Metrics.AuthOutcome("oidc", "failure")
 				http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
 				return
 			}
 
 			if err := userInfo.Claims(&claims); err != nil {
-				opt.Logger.Error().Err(err).Interface("userinfo", userInfo).Msg("failed to unmarshal userinfo claims")
+				l.Error().Err(err).Interface("userinfo", userInfo).Msg("failed to unmarshal userinfo claims")
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
+			opt.Metrics.AuthOutcome("oidc", "success")
+
 			//TODO: This should be read from the token instead of config
 			claims.Iss = opt.OIDCIss
 
@@ -92,7 +100,7 @@ func OpenIDConnect(opts ...Option) func(next http.Handler) http.Handler {
 			ctxWithClaims := ocisoidc.NewContext(r.Context(), &claims)
 			r = r.WithContext(ctxWithClaims)
 
-			opt.Logger.Debug().Interface("claims", claims).Interface("userInfo", userInfo).Msg("unmarshalled userinfo")
+			l.Debug().Interface("claims", claims).Interface("userInfo", userInfo).Msg("unmarshalled userinfo")
 			// store claims in context
 			// uses the original context, not the one with probably reduced security
 			nr := r.WithContext(ocisoidc.NewContext(r.Context(), &claims))
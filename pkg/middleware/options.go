@@ -1,13 +1,18 @@
 package middleware
 
 import (
-	settings "github.com/owncloud/ocis-settings/pkg/proto/v0"
+	"io"
 	"net/http"
 
+	settings "github.com/owncloud/ocis-settings/pkg/proto/v0"
+
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	acc "github.com/owncloud/ocis-accounts/pkg/proto/v0"
 	"github.com/owncloud/ocis-pkg/v2/log"
 	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/metrics"
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+	"github.com/owncloud/ocis-proxy/pkg/request"
 	storepb "github.com/owncloud/ocis-store/pkg/proto/v0"
 )
 
@@ -36,6 +41,24 @@ type Options struct {
 	Store storepb.StoreService
 	// PreSignedURLConfig to configure the middleware
 	PreSignedURLConfig config.PreSignedURL
+	// AccessLogConfig to configure the access log middleware
+	AccessLogConfig config.AccessLog
+	// AccessLogWriter the access log is written to
+	AccessLogWriter io.Writer
+	// Metrics to record the request and authentication metrics
+	Metrics *metrics.Metrics
+	// PolicySelector to select the proxy-policy of a request
+	PolicySelector policy.Selector
+	// ClientCertAuthConfig to configure the client certificate authentication
+	ClientCertAuthConfig config.ClientCertAuth
+	// AllowedPolicies the requests may be routed to
+	AllowedPolicies []string
+	// NoProvisioningPolicies are the policies for which unknown accounts are not created
+	NoProvisioningPolicies []string
+	// TrustedProxies whose forwarding headers are honoured
+	TrustedProxies request.TrustedProxies
+	// HTTPSRedirectConfig to configure the https redirect middleware
+	HTTPSRedirectConfig config.HTTPSRedirect
 }
 
 // newOptions initializes the available default options.
@@ -118,3 +141,66 @@ func PreSignedURLConfig(cfg config.PreSignedURL) Option {
 		o.PreSignedURLConfig = cfg
 	}
 }
+
+// AccessLogConfig provides a function to set the AccessLog config
+func AccessLogConfig(cfg config.AccessLog) Option {
+	return func(o *Options) {
+		o.AccessLogConfig = cfg
+	}
+}
+
+// AccessLogWriter provides a function to set the writer of the access log
+func AccessLogWriter(w io.Writer) Option {
+	return func(o *Options) {
+		o.AccessLogWriter = w
+	}
+}
+
+// Metrics provides a function to set the metrics option.
+func Metrics(m *metrics.Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+// PolicySelector provides a function to set the policy selector option.
+func PolicySelector(val policy.Selector) Option {
+	return func(o *Options) {
+		o.PolicySelector = val
+	}
+}
+
+// ClientCertAuthConfig provides a function to set the ClientCertAuthConfig option.
+func ClientCertAuthConfig(cfg config.ClientCertAuth) Option {
+	return func(o *Options) {
+		o.ClientCertAuthConfig = cfg
+	}
+}
+
+// AllowedPolicies provides a function to set the AllowedPolicies option.
+func AllowedPolicies(val []string) Option {
+	return func(o *Options) {
+		o.AllowedPolicies = val
+	}
+}
+
+// NoProvisioningPolicies provides a function to set the NoProvisioningPolicies option.
+func NoProvisioningPolicies(val []string) Option {
+	return func(o *Options) {
+		o.NoProvisioningPolicies = val
+	}
+}
+
+// TrustedProxies provides a function to set the TrustedProxies option.
+func TrustedProxies(val request.TrustedProxies) Option {
+	return func(o *Options) {
+		o.TrustedProxies = val
+	}
+}
+
+// HTTPSRedirectConfig provides a function to set the HTTPSRedirectConfig option.
+func HTTPSRedirectConfig(cfg config.HTTPSRedirect) Option {
+	return func(o *Options) {
+		o.HTTPSRedirectConfig = cfg
+	}
+}
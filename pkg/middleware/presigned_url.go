@@ -11,6 +11,7 @@ import (
 	"github.com/owncloud/ocis-pkg/v2/log"
 	ocisoidc "github.com/owncloud/ocis-pkg/v2/oidc"
 	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
 	storepb "github.com/owncloud/ocis-store/pkg/proto/v0"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -29,7 +30,9 @@ func PresignedURL(opts ...Option) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if isSignedRequest(r) {
-				if signedRequestIsValid(l, r, opt.Store, cfg) {
+				if signedRequestIsValid(request.Logger(r.Context(), l), r, opt.Store, cfg) {
+					opt.Metrics.AuthOutcome("presigned_url", "valid")
+
 					// use openid claims to let the account_uuid middleware do a lookup by username
 					claims := ocisoidc.StandardClaims{
 						OcisID: r.URL.Query().Get("OC-Credential"),
@@ -41,6 +44,7 @@ func PresignedURL(opts ...Option) func(next http.Handler) http.Handler {
 
 					next.ServeHTTP(w, r)
 				} else {
+					opt.Metrics.AuthOutcome("presigned_url", "invalid")
 					http.Error(w, "Invalid url signature", http.StatusUnauthorized)
 					return
 				}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	grpcmetadata "google.golang.org/grpc/metadata"
+)
+
+// RequestID provides a middleware which accepts the X-Request-ID header of the client or generates a new id. The id
+// is stored in the request context, forwarded to the backends and the ocis and reva services and echoed on the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(request.IDHeader)
+		if !request.ValidID(id) {
+			id = request.NewID()
+		}
+
+		ctx := request.NewIDContext(r.Context(), id)
+		// go-micro clients forward the metadata to the ocis services
+		ctx = metadata.Set(ctx, request.IDHeader, id)
+		// plain grpc clients like the reva gateway client use the outgoing grpc metadata
+		ctx = grpcmetadata.AppendToOutgoingContext(ctx, strings.ToLower(request.IDHeader), id)
+
+		r.Header.Set(request.IDHeader, id)
+		w.Header().Set(request.IDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
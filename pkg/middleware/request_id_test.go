@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		header   string
+		generate bool
+	}{
+		{"", true},
+		{"some-request-id", false},
+		{"invalid request id", true},
+	}
+
+	for _, tt := range tests {
+		var ctxID, headerID string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctxID = request.IDFromContext(r.Context())
+			headerID = r.Header.Get(request.IDHeader)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+		if tt.header != "" {
+			r.Header.Set(request.IDHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+		RequestID(next).ServeHTTP(w, r)
+
+		if ctxID == "" {
+			t.Errorf("with %q expected a request id in the context", tt.header)
+		}
+
+		if !tt.generate && ctxID != tt.header {
+			t.Errorf("with %q expected the request id to be kept got %q", tt.header, ctxID)
+		}
+
+		if tt.generate && ctxID == tt.header {
+			t.Errorf("with %q expected a generated request id", tt.header)
+		}
+
+		if headerID != ctxID {
+			t.Errorf("with %q expected the request id %q to be forwarded got %q", tt.header, ctxID, headerID)
+		}
+
+		if got := w.Header().Get(request.IDHeader); got != ctxID {
+			t.Errorf("with %q expected the request id %q on the response got %q", tt.header, ctxID, got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		bytes   int
+	}{
+		{
+			name:    "nothing written",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			status:  http.StatusOK,
+		},
+		{
+			name: "body only",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, "hello")
+			},
+			status: http.StatusOK,
+			bytes:  5,
+		},
+		{
+			name: "first status wins",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = io.WriteString(w, "not found")
+			},
+			status: http.StatusNotFound,
+			bytes:  9,
+		},
+	}
+
+	for _, tt := range tests {
+		rr := newResponseRecorder(httptest.NewRecorder())
+		tt.handler(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rr.Status() != tt.status || rr.BytesWritten() != tt.bytes {
+			t.Errorf("%s: expected %d and %d bytes got %d and %d bytes", tt.name, tt.status, tt.bytes, rr.Status(), rr.BytesWritten())
+		}
+	}
+}
+
+func TestResponseRecorderHijack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := newResponseRecorder(w).Hijack()
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		_ = buf.Flush()
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected %d got %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	// httptest.ResponseRecorder can not be hijacked
+	if _, _, err := newResponseRecorder(httptest.NewRecorder()).Hijack(); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+	"github.com/owncloud/ocis-proxy/pkg/render"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"go.opencensus.io/trace"
+)
+
+// SelectPolicy provides a middleware which selects the proxy-policy of a request and stores it in the request context.
+// It must run after the authentication middlewares so the selector can see the oidc claims.
+func SelectPolicy(opts ...Option) func(next http.Handler) http.Handler {
+	opt := newOptions(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opt.PolicySelector == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, span := trace.StartSpan(policy.NewCookieContext(r.Context()), "proxy.policy.select")
+			pol, err := opt.PolicySelector(ctx, r.WithContext(ctx))
+			span.End()
+
+			for _, c := range policy.Cookies(ctx) {
+				http.SetCookie(w, c)
+			}
+
+			if err != nil {
+				l := request.Logger(r.Context(), opt.Logger)
+				l.Error().Err(err).Str("path", r.URL.Path).Msg("could not select a policy")
+				render.Error(w, r, http.StatusServiceUnavailable, "could not select a policy")
+				return
+			}
+
+			if info := request.InfoFromContext(r.Context()); info != nil {
+				info.Policy = pol
+			}
+
+			next.ServeHTTP(w, r.WithContext(policy.NewContext(r.Context(), pol)))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"github.com/owncloud/ocis-proxy/pkg/tracing"
+	"go.opencensus.io/trace"
+)
+
+// Tracing provides a middleware which starts the root span of a request, so the spans of the following middlewares
+// and the upstream call belong to the same trace. Trace contexts sent by the client are continued.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.StartServerSpan(r, r.URL.Path)
+		defer span.End()
+
+		span.AddAttributes(
+			trace.StringAttribute("http.method", r.Method),
+			trace.StringAttribute("http.path", r.URL.Path),
+			trace.StringAttribute("request_id", request.IDFromContext(ctx)),
+		)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/owncloud/ocis-proxy/pkg/render"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+)
+
+var (
+	// ErrNoRoute is returned when none of the routes of the selected policy matches the request.
+	ErrNoRoute = errors.New("no route found for request")
+	// ErrUnknownPolicy is returned when the policy-selector selects a policy which is not configured.
+	ErrUnknownPolicy = errors.New("selected policy is not configured")
+	// ErrPolicySelection is returned when the policy-selector fails to select a policy.
+	ErrPolicySelection = errors.New("could not select a policy")
+)
+
+// statusClientClosedRequest is logged when the client went away before the backend responded, like nginx does.
+const statusClientClosedRequest = 499
+
+// errorHandler is used by the reverse proxy to report routing errors and errors returned by the backends.
+func (p *MultiHostReverseProxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := errorStatus(err)
+
+	l := request.Logger(r.Context(), p.logger)
+	if status == statusClientClosedRequest {
+		// not a backend failure, nobody is waiting for the response
+		l.Debug().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Msg("client closed the request")
+		trace.FromContext(r.Context()).SetStatus(trace.Status{Code: trace.StatusCodeCancelled, Message: message})
+		w.WriteHeader(status)
+		return
+	}
+
+	l.Error().
+		Err(err).
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Int("status", status).
+		Msg("could not proxy request")
+
+	if !isRoutingError(err) {
+		if info := request.InfoFromContext(r.Context()); info != nil {
+			p.metrics.UpstreamError(info.Policy, info.Backend, status)
+		} else {
+			p.metrics.UpstreamError("", "", status)
+		}
+	}
+
+	trace.FromContext(r.Context()).SetStatus(ochttp.TraceStatus(status, message))
+
+	render.Error(w, r, status, message)
+}
+
+// isRoutingError reports whether err occurred before the request was sent to a backend.
+func isRoutingError(err error) bool {
+	return errors.Is(err, ErrNoRoute) || errors.Is(err, ErrUnknownPolicy) || errors.Is(err, ErrPolicySelection)
+}
+
+// errorStatus maps an error to the status code and message sent to the client.
+func errorStatus(err error) (int, string) {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, "The client closed the request."
+	case errors.Is(err, ErrNoRoute):
+		return http.StatusNotFound, "No route found for the requested resource."
+	case errors.Is(err, ErrUnknownPolicy), errors.Is(err, ErrPolicySelection):
+		return http.StatusServiceUnavailable, "The service is temporarily unavailable."
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout, "The backend did not respond in time."
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return http.StatusServiceUnavailable, "The backend is not available."
+	default:
+		return http.StatusBadGateway, "The backend could not handle the request."
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// RouteEntry is a route of the route table.
+type RouteEntry struct {
+	Policy      string
+	Type        config.RouteType
+	Endpoint    string
+	Backend     string
+	ApacheVHost bool
+}
+
+// Explanation describes how a request is routed.
+type Explanation struct {
+	// Policy is the selected policy
+	Policy string
+	// RouteType is the type of the matched route
+	RouteType string
+	// Endpoint is the endpoint of the matched route
+	Endpoint string
+	// Backend is the backend of the matched route
+	Backend string
+	// Upstream is the url the request is proxied to
+	Upstream string
+	// Host is the host header sent upstream
+	Host string
+}
+
+// Routes returns the route table in the order of the configuration.
+func (p *MultiHostReverseProxy) Routes() []RouteEntry {
+	var routes []RouteEntry
+	for _, pol := range p.config.Policies {
+		for _, rt := range pol.Routes {
+			routeType := config.DefaultRouteType
+			if rt.Type != "" {
+				routeType = rt.Type
+			}
+			routes = append(routes, RouteEntry{
+				Policy:      pol.Name,
+				Type:        routeType,
+				Endpoint:    rt.Endpoint,
+				Backend:     rt.Backend,
+				ApacheVHost: rt.ApacheVHost,
+			})
+		}
+	}
+	return routes
+}
+
+// Explain selects the policy and route for a request like ServeHTTP does, without sending it upstream.
+func (p *MultiHostReverseProxy) Explain(r *http.Request) (*Explanation, error) {
+	ctx, info := request.EnsureInfo(r.Context())
+	out := r.Clone(ctx)
+
+	director, err := p.selectDirector(out)
+	if err != nil {
+		return &Explanation{Policy: info.Policy}, err
+	}
+	director(out)
+
+	return &Explanation{
+		Policy:    info.Policy,
+		RouteType: info.RouteType,
+		Endpoint:  info.Endpoint,
+		Backend:   info.Backend,
+		Upstream:  out.URL.String(),
+		Host:      out.Host,
+	}, nil
+}
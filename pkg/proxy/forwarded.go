@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// forwardingHeaders are replaced by the proxy, the values sent by clients are never passed on as they are.
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+	"X-Forwarded-Prefix",
+}
+
+// setForwardedHeaders sets the forwarding headers of the route from the client side of the request. The reverse
+// proxy appends the address of the connected client to X-Forwarded-For, so behind trusted proxies only the client is
+// set here. Routes without X-Forwarded-* headers are marked with omitXForwardedFor.
+func setForwardedHeaders(req *http.Request, f request.Forwarded, rt config.Route) {
+	for _, h := range forwardingHeaders {
+		req.Header.Del(h)
+	}
+
+	mode := forwardedMode(rt)
+	if mode == config.ForwardedNone {
+		return
+	}
+
+	if mode == config.ForwardedX || mode == config.ForwardedBoth {
+		if f.Proxied {
+			req.Header.Set("X-Forwarded-For", f.For)
+		}
+		req.Header.Set("X-Forwarded-Proto", f.Proto)
+		req.Header.Set("X-Forwarded-Host", f.Host)
+		if rt.ForwardedPrefix != "" {
+			req.Header.Set("X-Forwarded-Prefix", rt.ForwardedPrefix)
+		}
+	}
+
+	if mode == config.ForwardedRFC7239 || mode == config.ForwardedBoth {
+		req.Header.Set("Forwarded", forwardedElement(f))
+	}
+}
+
+func forwardedMode(rt config.Route) string {
+	if rt.Forwarded == "" {
+		return config.ForwardedX
+	}
+	return rt.Forwarded
+}
+
+type xForwardedForKey struct{}
+
+// xForwardedFor is the X-Forwarded-For header of a request to a route which does not send the X-Forwarded-* headers.
+// The reverse proxy appends the address of the connected client after the director ran, the transport sends the
+// header as the director left it, e.g. only with the values set by header rules.
+type xForwardedFor struct {
+	omit   bool
+	values []string
+}
+
+func newXForwardedForContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, xForwardedForKey{}, &xForwardedFor{})
+}
+
+func xForwardedForFromContext(ctx context.Context) *xForwardedFor {
+	if xff, ok := ctx.Value(xForwardedForKey{}).(*xForwardedFor); ok {
+		return xff
+	}
+	return nil
+}
+
+// omitXForwardedFor records the X-Forwarded-For header of the request if its route does not send X-Forwarded-*
+// headers. It must be called after all changes of the director to the headers.
+func omitXForwardedFor(req *http.Request, rt config.Route) {
+	switch forwardedMode(rt) {
+	case config.ForwardedNone, config.ForwardedRFC7239:
+		if xff := xForwardedForFromContext(req.Context()); xff != nil {
+			xff.omit, xff.values = true, req.Header["X-Forwarded-For"]
+		}
+	}
+}
+
+// forwardedElement returns the element of the Forwarded header describing the client side of the request.
+func forwardedElement(f request.Forwarded) string {
+	var pairs []string
+	if f.For != "" {
+		node := f.For
+		if ip := net.ParseIP(node); ip != nil && ip.To4() == nil {
+			node = "[" + node + "]"
+		}
+		pairs = append(pairs, "for="+forwardedValue(node))
+	}
+	if f.Host != "" {
+		pairs = append(pairs, "host="+forwardedValue(f.Host))
+	}
+	pairs = append(pairs, "proto="+forwardedValue(f.Proto))
+	return strings.Join(pairs, ";")
+}
+
+// forwardedValue quotes values which are not a token, e.g. IPv6 addresses and hosts with a port.
+func forwardedValue(v string) string {
+	for _, c := range v {
+		if !isTokenChar(c) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		}
+	}
+	return v
+}
+
+func isTokenChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
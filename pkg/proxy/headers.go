@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+)
+
+// headerRule is a config.HeaderRule with the template of the value parsed.
+type headerRule struct {
+	action string
+	name   string
+	to     string
+	value  *template.Template
+}
+
+func parseHeaderRules(rules []config.HeaderRule) ([]headerRule, error) {
+	parsed := make([]headerRule, 0, len(rules))
+	for _, r := range rules {
+		h := headerRule{action: r.Action, name: r.Name}
+		switch r.Action {
+		case config.HeaderAdd, config.HeaderSet:
+			tpl, err := template.New(r.Name).Option("missingkey=error").Parse(r.Value)
+			if err != nil {
+				return nil, err
+			}
+			h.value = tpl
+		case config.HeaderRename:
+			h.to = r.Value
+		}
+		parsed = append(parsed, h)
+	}
+	return parsed, nil
+}
+
+// applyHeaderRules applies the rules in order. The templates are executed with env, see policy.RequestEnv.
+func applyHeaderRules(h http.Header, rules []headerRule, env map[string]interface{}) {
+	for _, r := range rules {
+		switch r.action {
+		case config.HeaderAdd:
+			if v, ok := headerValue(r.value, env); ok {
+				h.Add(r.name, v)
+			}
+		case config.HeaderSet:
+			if v, ok := headerValue(r.value, env); ok {
+				h.Set(r.name, v)
+			} else {
+				h.Del(r.name)
+			}
+		case config.HeaderRemove:
+			h.Del(r.name)
+		case config.HeaderRename:
+			values := h[http.CanonicalHeaderKey(r.name)]
+			h.Del(r.name)
+			for _, v := range values {
+				h.Add(r.to, v)
+			}
+		}
+	}
+}
+
+// headerValue executes the template. It fails if the template refers to a missing value, e.g. a claim of an
+// unauthenticated request.
+func headerValue(tpl *template.Template, env map[string]interface{}) (string, bool) {
+	var b strings.Builder
+	if err := tpl.Execute(&b, env); err != nil {
+		return "", false
+	}
+	// header values must not contain line breaks
+	return strings.NewReplacer("\r", "", "\n", "").Replace(b.String()), true
+}
+
+type responseRulesKey struct{}
+
+// responseRules are the response header rules of the route selected for a request. The director of the route sets
+// them, modifyResponse applies them.
+type responseRules struct {
+	rules []headerRule
+	env   map[string]interface{}
+}
+
+func newResponseRulesContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, responseRulesKey{}, &responseRules{})
+}
+
+func responseRulesFromContext(ctx context.Context) *responseRules {
+	if rr, ok := ctx.Value(responseRulesKey{}).(*responseRules); ok {
+		return rr
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"sync"
+	"time"
+)
+
+// policyCache remembers the policy selected for a user.
+type policyCache struct {
+	entries map[string]policyCacheEntry
+	size    int
+	m       sync.Mutex
+}
+
+type policyCacheEntry struct {
+	policy  string
+	expires time.Time
+}
+
+func newPolicyCache(size int) *policyCache {
+	return &policyCache{
+		entries: map[string]policyCacheEntry{},
+		size:    size,
+	}
+}
+
+// get returns the policy of a user if it has not expired at now.
+func (c *policyCache) get(user string, now time.Time) (string, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[user]
+	if !ok || !now.Before(e.expires) {
+		return "", false
+	}
+	return e.policy, true
+}
+
+// lastKnown returns the policy of a user even if it has expired.
+func (c *policyCache) lastKnown(user string) (string, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[user]
+	return e.policy, ok
+}
+
+// set stores the policy of a user until expires. Expired entries are kept as last known policy until the cache is
+// full.
+func (c *policyCache) set(user, policy string, expires time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, ok := c.entries[user]; !ok && len(c.entries) >= c.size {
+		c.evict()
+	}
+	c.entries[user] = policyCacheEntry{policy: policy, expires: expires}
+}
+
+// evict removes the expired entries, or a random one if none has expired.
+func (c *policyCache) evict() {
+	now := time.Now()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	if len(c.entries) < c.size {
+		return
+	}
+
+	for k := range c.entries {
+		delete(c.entries, k)
+		return
+	}
+}
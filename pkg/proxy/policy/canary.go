@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+
+	"github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/metrics"
+)
+
+const defaultCanaryClaim = "preferred_username"
+
+// NewCanarySelector assigns a percentage of the users to the canary policy. A user is assigned by a stable hash of the
+// user id, so each user always stays on the same side. Users on the allow list always get the canary policy, users on
+// the deny list never do. The deny list takes precedence.
+//
+//	"policy_selector": {
+//	   "canary": {
+//	     "policy": "reva",
+//	     "default_policy": "oc10",
+//	     "unauthenticated_policy": "oc10",
+//	     "percentage": 10,
+//	     "claim": "preferred_username",
+//	     "allow": ["einstein"],
+//	     "deny": ["marie"]
+//	   }
+//	 },
+//
+// The user id is taken from "claim", which defaults to "preferred_username". Every selection is counted in the
+// policy_selections_total metric.
+func NewCanarySelector(cfg *config.CanarySelectorConf, m *metrics.Metrics) (Selector, error) {
+	if cfg.Percentage < 0 || cfg.Percentage > 100 {
+		return nil, fmt.Errorf("canary percentage must be between 0 and 100, got %d", cfg.Percentage)
+	}
+
+	claim := cfg.Claim
+	if claim == "" {
+		claim = defaultCanaryClaim
+	}
+
+	allow := stringSet(cfg.Allow)
+	deny := stringSet(cfg.Deny)
+
+	return func(ctx context.Context, r *http.Request) (string, error) {
+		policy := cfg.UnauthenticatedPolicy
+		if claims := oidc.FromContext(ctx); claims != nil {
+			userID, err := claimString(claims, claim)
+			if err != nil {
+				return "", err
+			}
+
+			switch {
+			case deny[userID]:
+				policy = cfg.DefaultPolicy
+			case allow[userID]:
+				policy = cfg.Policy
+			case userID != "" && canaryBucket(userID) < cfg.Percentage:
+				policy = cfg.Policy
+			default:
+				policy = cfg.DefaultPolicy
+			}
+		}
+
+		m.PolicySelected("canary", policy)
+		return policy, nil
+	}, nil
+}
+
+// canaryBucket maps a user id to a stable bucket between 0 and 99.
+func canaryBucket(userID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+	return int(h.Sum32() % 100)
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+)
+
+// chainStep is a loaded config.ChainSelectorStep
+type chainStep struct {
+	when     *config.RequestCondition
+	selector Selector
+}
+
+// NewChainSelector evaluates a list of selectors in order. A selector is skipped when the request does not match its
+// "when" condition. The first selector which returns a policy wins, a selector which returns no policy, e.g. a claims
+// selector without default policy, falls through to the next one. If no selector returns a policy the default policy
+// is used.
+//
+//	"policy_selector": {
+//	   "chain": {
+//	     "selectors": [
+//	       {"when": {"host": "legacy.example.com"}, "selector": {"static": {"policy": "oc10"}}},
+//	       {"selector": {"migration": {"acc_found_policy": "reva", "acc_not_found_policy": "oc10", "unauthenticated_policy": "oc10"}}}
+//	     ],
+//	     "default_policy": "oc10"
+//	   }
+//	 },
+//
+// The selectors of a chain are configured like the toplevel policy_selector and can be chains themselves.
+func NewChainSelector(cfg *config.ChainSelectorConf, opts ...Option) (Selector, error) {
+	steps := make([]chainStep, 0, len(cfg.Selectors))
+	for i := range cfg.Selectors {
+		step := cfg.Selectors[i]
+		if step.When != nil {
+			if err := validateRequestCondition(*step.When); err != nil {
+				return nil, fmt.Errorf("chain selector %d: %w", i, err)
+			}
+		}
+
+		sel, err := LoadSelector(&step.Selector, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("chain selector %d: %w", i, err)
+		}
+
+		steps = append(steps, chainStep{when: step.When, selector: sel})
+	}
+
+	return func(ctx context.Context, r *http.Request) (string, error) {
+		for _, step := range steps {
+			if step.when != nil && !matchRequestCondition(*step.when, r) {
+				continue
+			}
+
+			policy, err := step.selector(ctx, r)
+			if err != nil {
+				return "", err
+			}
+
+			if policy != "" {
+				return policy, nil
+			}
+		}
+
+		return cfg.DefaultPolicy, nil
+	}, nil
+}
@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+)
+
+// Operators to compare a claim with the value of a claims-selector rule.
+const (
+	OperatorEquals     = "equals"
+	OperatorContains   = "contains"
+	OperatorStartsWith = "starts_with"
+	OperatorEndsWith   = "ends_with"
+	OperatorRegex      = "regex"
+)
+
+// claimsRule is a compiled config.ClaimsSelectorRule
+type claimsRule struct {
+	config.ClaimsSelectorRule
+	re *regexp.Regexp
+}
+
+// NewClaimsSelector selects the policy by evaluating rules over the oidc claims of the authenticated user. The rules
+// are evaluated in order, the policy of the first matching rule is selected.
+//
+//	"policy_selector": {
+//	   "claims": {
+//	     "default_policy": "us-east-1",
+//	     "unauthenticated_policy": "us-east-1",
+//	     "rules": [
+//	       {"claim": "email", "operator": "ends_with", "value": "@eu.example.com", "policy": "eu-ams-1"},
+//	       {"claim": "groups", "operator": "contains", "value": "beta", "policy": "reva"}
+//	     ]
+//	   }
+//	 },
+//
+// For claims which are lists, like "groups", a rule matches if one of the entries matches.
+func NewClaimsSelector(cfg *config.ClaimsSelectorConf) (Selector, error) {
+	rules := make([]claimsRule, 0, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		rule := claimsRule{ClaimsSelectorRule: r}
+		switch r.Operator {
+		case "", OperatorEquals, OperatorContains, OperatorStartsWith, OperatorEndsWith:
+		case OperatorRegex:
+			re, err := regexp.Compile(r.Value)
+			if err != nil {
+				return nil, fmt.Errorf("claims rule %d: invalid regex %q: %w", i, r.Value, err)
+			}
+			rule.re = re
+		default:
+			return nil, fmt.Errorf("claims rule %d: unknown operator %q", i, r.Operator)
+		}
+		rules = append(rules, rule)
+	}
+
+	return func(ctx context.Context, r *http.Request) (string, error) {
+		claims := oidc.FromContext(ctx)
+		if claims == nil {
+			return cfg.UnauthenticatedPolicy, nil
+		}
+
+		values, err := claimsMap(claims)
+		if err != nil {
+			return "", err
+		}
+
+		for _, rule := range rules {
+			if rule.matches(values[rule.Claim]) {
+				return rule.Policy, nil
+			}
+		}
+
+		return cfg.DefaultPolicy, nil
+	}, nil
+}
+
+// matches reports whether the value of a claim matches the rule.
+func (r claimsRule) matches(claim interface{}) bool {
+	switch v := claim.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, e := range v {
+			if r.matchString(fmt.Sprint(e), true) {
+				return true
+			}
+		}
+		return false
+	default:
+		return r.matchString(fmt.Sprint(v), false)
+	}
+}
+
+// matchString compares s with the value of the rule. For entries of a list "contains" means equality.
+func (r claimsRule) matchString(s string, listEntry bool) bool {
+	switch r.Operator {
+	case OperatorContains:
+		if listEntry {
+			return s == r.Value
+		}
+		return strings.Contains(s, r.Value)
+	case OperatorStartsWith:
+		return strings.HasPrefix(s, r.Value)
+	case OperatorEndsWith:
+		return strings.HasSuffix(s, r.Value)
+	case OperatorRegex:
+		return r.re.MatchString(s)
+	default:
+		return s == r.Value
+	}
+}
+
+// claimsMap returns the claims as a generic map so they can be accessed by their json name.
+func claimsMap(claims *oidc.StandardClaims) (map[string]interface{}, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// claimString returns the value of a claim as string, or an empty string if the claim is not set.
+func claimString(claims *oidc.StandardClaims, claim string) (string, error) {
+	values, err := claimsMap(claims)
+	if err != nil {
+		return "", err
+	}
+
+	if v := values[claim]; v != nil {
+		return fmt.Sprint(v), nil
+	}
+	return "", nil
+}
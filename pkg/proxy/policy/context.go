@@ -0,0 +1,16 @@
+package policy
+
+import "context"
+
+type policyKey struct{}
+
+// NewContext returns a new context with the selected policy.
+func NewContext(ctx context.Context, policy string) context.Context {
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+// FromContext returns the policy selected for the request, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	policy, ok := ctx.Value(policyKey{}).(string)
+	return policy, ok
+}
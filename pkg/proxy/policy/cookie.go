@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type cookiesKey struct{}
+
+// responseCookies collects the cookies selectors want to set on the response.
+type responseCookies struct {
+	cookies []*http.Cookie
+	m       sync.Mutex
+}
+
+// NewCookieContext returns a context in which selectors can record cookies for the response. The caller is expected
+// to set the cookies returned by Cookies on the response.
+func NewCookieContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cookiesKey{}, &responseCookies{})
+}
+
+// SetCookie records a cookie for the response. It is a noop if ctx was not created by NewCookieContext.
+func SetCookie(ctx context.Context, c *http.Cookie) {
+	if rc, ok := ctx.Value(cookiesKey{}).(*responseCookies); ok {
+		rc.m.Lock()
+		rc.cookies = append(rc.cookies, c)
+		rc.m.Unlock()
+	}
+}
+
+// Cookies returns the cookies recorded in ctx.
+func Cookies(ctx context.Context) []*http.Cookie {
+	rc, ok := ctx.Value(cookiesKey{}).(*responseCookies)
+	if !ok {
+		return nil
+	}
+
+	rc.m.Lock()
+	defer rc.m.Unlock()
+	return rc.cookies
+}
+
+// stickyCookie records the policy selected for a user. The value is signed with the secret and bound to the user, so
+// it can not be used to pick another policy or be reused by another user.
+type stickyCookie struct {
+	name   string
+	secret string
+}
+
+func (s stickyCookie) enabled() bool {
+	return s.name != "" && s.secret != ""
+}
+
+// set records the cookie for the response unless the request already carries it.
+func (s stickyCookie) set(ctx context.Context, r *http.Request, user, policy string) {
+	if !s.enabled() {
+		return
+	}
+
+	if current, ok := s.get(r, user); ok && current == policy {
+		return
+	}
+
+	SetCookie(ctx, &http.Cookie{
+		Name:     s.name,
+		Value:    base64.RawURLEncoding.EncodeToString([]byte(policy)) + "." + s.sign(user, policy),
+		Path:     "/",
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// get returns the policy recorded in the cookie of the request if its signature is valid for user.
+func (s stickyCookie) get(r *http.Request, user string) (string, bool) {
+	if !s.enabled() {
+		return "", false
+	}
+
+	c, err := r.Cookie(s.name)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.SplitN(c.Value, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+
+	policy, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(s.sign(user, string(policy)))) {
+		return "", false
+	}
+
+	return string(policy), true
+}
+
+func (s stickyCookie) sign(user, policy string) string {
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	_, _ = mac.Write([]byte(user + "\n" + policy))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
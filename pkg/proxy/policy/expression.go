@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/compiler"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/vm"
+	"github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// NewExpressionSelector selects the policy by evaluating an expression in the expr language
+// (https://github.com/antonmedv/expr). The expression must return the name of the policy, an empty string falls
+// through in a chain selector.
+//
+//	"policy_selector": {
+//	   "expression": {
+//	     "expression": "host == 'legacy.example.com' ? 'oc10' : ('beta' in claims.groups ? 'reva' : 'oc10')"
+//	   }
+//	 },
+//
+// The expression can use the variables
+//
+//	method        string                  the request method
+//	host          string                  the request host without port
+//	path          string                  the request path
+//	query         map[string]string       the first value of each query parameter
+//	headers       map[string]string       the first value of each request header, by canonical name
+//	cookies       map[string]string       the request cookies
+//	authenticated bool                    whether the request carries oidc claims
+//	claims        map[string]interface{}  the oidc claims by their json name, e.g. claims.email
+//
+// The expression is compiled and type-checked when the selector is created.
+func NewExpressionSelector(cfg *config.ExpressionSelectorConf) (Selector, error) {
+	program, err := compileExpression(cfg.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, r *http.Request) (string, error) {
+		return runExpression(ctx, program, r)
+	}, nil
+}
+
+// EvalExpression compiles an expression and evaluates it against a request, e.g. one recorded with
+// httputil.DumpRequest and read back with http.ReadRequest. The oidc claims are taken from the request context. It
+// is meant for testing expressions before putting them into the configuration.
+func EvalExpression(expression string, r *http.Request) (string, error) {
+	program, err := compileExpression(expression)
+	if err != nil {
+		return "", err
+	}
+
+	return runExpression(r.Context(), program, r)
+}
+
+// compileExpression compiles the expression and checks that it returns a string.
+func compileExpression(expression string) (*vm.Program, error) {
+	program, err := compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy expression %q: %w", expression, err)
+	}
+	return program, nil
+}
+
+// compile parses and type-checks the expression once and compiles the checked tree. expr.Compile does not return the
+// type of the result, which must be a string or unknown, e.g. a claim.
+func compile(expression string) (*vm.Program, error) {
+	config := conf.New(expressionEnvTypes())
+
+	tree, err := parser.Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := checker.Check(tree, config)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil && t.Kind() != reflect.String && t.Kind() != reflect.Interface {
+		return nil, fmt.Errorf("must return a string, got %v", t)
+	}
+
+	return compiler.Compile(tree, config)
+}
+
+func runExpression(ctx context.Context, program *vm.Program, r *http.Request) (string, error) {
+	env, err := RequestEnv(ctx, r)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := expr.Run(program, env)
+	if err != nil {
+		return "", fmt.Errorf("could not evaluate policy expression: %w", err)
+	}
+
+	switch policy := out.(type) {
+	case string:
+		return policy, nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("policy expression returned %T instead of a string", out)
+	}
+}
+
+// expressionEnvTypes returns an environment with the types of the variables for type-checking.
+func expressionEnvTypes() map[string]interface{} {
+	return map[string]interface{}{
+		"method":        "",
+		"host":          "",
+		"path":          "",
+		"query":         map[string]string{},
+		"headers":       map[string]string{},
+		"cookies":       map[string]string{},
+		"authenticated": false,
+		"claims":        map[string]interface{}{},
+	}
+}
+
+// RequestEnv returns the variables for a request, see NewExpressionSelector. They are also used by the header
+// templates of routes.
+func RequestEnv(ctx context.Context, r *http.Request) (map[string]interface{}, error) {
+	query := map[string]string{}
+	for k, v := range r.URL.Query() {
+		query[k] = v[0]
+	}
+
+	headers := map[string]string{}
+	for k, v := range r.Header {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+
+	cookies := map[string]string{}
+	for _, c := range r.Cookies() {
+		if _, ok := cookies[c.Name]; !ok {
+			cookies[c.Name] = c.Value
+		}
+	}
+
+	values := map[string]interface{}{}
+	claims := oidc.FromContext(ctx)
+	if claims != nil {
+		var err error
+		if values, err = claimsMap(claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"method":        r.Method,
+		"host":          hostname(request.ForwardedFrom(r).Host),
+		"path":          r.URL.Path,
+		"query":         query,
+		"headers":       headers,
+		"cookies":       cookies,
+		"authenticated": claims != nil,
+		"claims":        values,
+	}, nil
+}
@@ -0,0 +1,192 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	merrors "github.com/micro/go-micro/v2/errors"
+	accounts "github.com/owncloud/ocis-accounts/pkg/proto/v0"
+	"github.com/owncloud/ocis-pkg/v2/oidc"
+	"github.com/owncloud/ocis-proxy/pkg/config"
+)
+
+// Behaviours of the migration-selector when the accounts-service can not be reached.
+const (
+	// OnErrorFail fails the request, the proxy responds with 503 Service Unavailable.
+	OnErrorFail = "fail"
+	// OnErrorLastKnown selects the last known policy of the user, from the cache or the sticky cookie.
+	OnErrorLastKnown = "last_known"
+)
+
+// Account properties the migration-selector can match the claim against.
+const (
+	MatchID       = "id"
+	MatchUsername = "username"
+	MatchEmail    = "email"
+)
+
+const defaultMigrationClaim = "preferred_username"
+
+// maxMigrationCacheEntries limits the number of users the migration-selector keeps in memory.
+const maxMigrationCacheEntries = 10000
+
+// ErrAccountsUnavailable is returned by the migration-selector when the accounts-service could not be asked.
+var ErrAccountsUnavailable = errors.New("accounts service unavailable")
+
+// NewMigrationSelector selects the policy based on the existence of the user in the accounts-service. The user is
+// identified by the oidc claim "claim", default "preferred_username", which is matched against the account "id",
+// "username" (default) or "email". The policy for each case is configurable:
+//
+//	"policy_selector": {
+//	   "migration": {
+//	     "acc_found_policy" : "reva",
+//	     "acc_not_found_policy": "oc10",
+//	     "unauthenticated_policy": "oc10",
+//	     "claim": "email",
+//	     "match": "email",
+//	     "positive_cache_ttl": "5m",
+//	     "negative_cache_ttl": "1m",
+//	     "on_error": "last_known",
+//	     "cookie": "ocis-proxy-policy"
+//	   }
+//	 },
+//
+// This selector can be used in migration-scenarios where some users have already migrated from ownCloud10 to OCIS and
+// thus have an entry in ocis-accounts. All users without accounts entry are routed to the legacy ownCloud10 instance.
+//
+// Found and not found accounts are cached for the configured durations, e.g. "5m". Errors of the accounts-service other
+// than "not found", e.g. timeouts, fail the request unless "on_error" is "last_known", in which case the last known
+// policy of the user is used. When "cookie" is set the selected policy is recorded in a cookie signed with the
+// CookieSecret option, it is only read when the accounts-service is unavailable.
+func NewMigrationSelector(cfg *config.MigrationSelectorConf, ss accounts.AccountsService, opts ...Option) (Selector, error) {
+	options := newOptions(opts...)
+	cache := newPolicyCache(maxMigrationCacheEntries)
+	cookie := stickyCookie{name: cfg.Cookie, secret: options.CookieSecret}
+
+	claim := cfg.Claim
+	if claim == "" {
+		claim = defaultMigrationClaim
+	}
+
+	match := cfg.Match
+	switch match {
+	case "":
+		match = MatchUsername
+	case MatchID, MatchUsername, MatchEmail:
+	default:
+		return nil, fmt.Errorf("migration selector: unknown match %q", cfg.Match)
+	}
+
+	var acc = ss
+	return func(ctx context.Context, r *http.Request) (s string, err error) {
+		claims := oidc.FromContext(r.Context())
+		if claims == nil {
+			return cfg.UnauthenticatedPolicy, nil
+		}
+
+		userID, err := claimString(claims, claim)
+		if err != nil {
+			return "", err
+		}
+		if userID == "" {
+			// without the claim the account can not be looked up
+			options.Metrics.PolicySelected("migration", cfg.AccNotFoundPolicy)
+			return cfg.AccNotFoundPolicy, nil
+		}
+
+		now := time.Now()
+		policy, ok := cache.get(userID, now)
+		if !ok {
+			found, err := accountExists(ctx, acc, match, userID)
+			switch {
+			case err != nil:
+				return lastKnownPolicy(cfg, cache, cookie, r, userID, err)
+			case found:
+				policy = cfg.AccFoundPolicy
+				cache.set(userID, policy, now.Add(cfg.PositiveCacheTTL))
+			default:
+				policy = cfg.AccNotFoundPolicy
+				cache.set(userID, policy, now.Add(cfg.NegativeCacheTTL))
+			}
+		}
+
+		cookie.set(ctx, r, userID, policy)
+		options.Metrics.PolicySelected("migration", policy)
+		return policy, nil
+	}, nil
+}
+
+// NotMigratedPolicies returns the acc_not_found policies of the migration-selectors in the configuration, including
+// the ones in chains. Accounts must not be provisioned for requests routed to them, otherwise the users would be
+// routed to the acc_found policy on their next request.
+func NotMigratedPolicies(cfg *config.PolicySelector) []string {
+	if cfg == nil {
+		return nil
+	}
+	var policies []string
+	if cfg.Migration != nil && cfg.Migration.AccNotFoundPolicy != cfg.Migration.AccFoundPolicy {
+		policies = append(policies, cfg.Migration.AccNotFoundPolicy)
+	}
+	if cfg.Chain != nil {
+		for i := range cfg.Chain.Selectors {
+			policies = append(policies, NotMigratedPolicies(&cfg.Chain.Selectors[i].Selector)...)
+		}
+	}
+	return policies
+}
+
+// accountExists looks up the account with the given id, username or email like the AccountUUID middleware does.
+func accountExists(ctx context.Context, acc accounts.AccountsService, match, value string) (bool, error) {
+	var property string
+	switch match {
+	case MatchID:
+		property = "id"
+	case MatchEmail:
+		property = "mail"
+	default:
+		property = "preferred_name"
+	}
+
+	resp, err := acc.ListAccounts(ctx, &accounts.ListAccountsRequest{
+		Query:    fmt.Sprintf("%s eq '%s'", property, strings.ReplaceAll(value, "'", "''")),
+		PageSize: 1,
+	})
+	switch {
+	case err == nil:
+		return len(resp.Accounts) > 0, nil
+	case isNotFound(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// lastKnownPolicy is used when the accounts-service failed. It returns the last known policy of the user if the
+// selector is configured to do so.
+func lastKnownPolicy(cfg *config.MigrationSelectorConf, cache *policyCache, cookie stickyCookie, r *http.Request, userID string, err error) (string, error) {
+	if cfg.OnError == OnErrorLastKnown {
+		if policy, ok := cache.lastKnown(userID); ok {
+			return policy, nil
+		}
+		if policy, ok := cookie.get(r, userID); ok {
+			return policy, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %v", ErrAccountsUnavailable, err)
+}
+
+// isNotFound reports whether err of the accounts-service means that the account does not exist.
+func isNotFound(err error) bool {
+	e := merrors.Parse(err.Error())
+	if e.Code == http.StatusNotFound {
+		return true
+	}
+
+	// older accounts-services report a missing account without a status code
+	return strings.Contains(e.Detail, "account not found")
+}
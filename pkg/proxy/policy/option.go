@@ -0,0 +1,48 @@
+package policy
+
+import (
+	accounts "github.com/owncloud/ocis-accounts/pkg/proto/v0"
+	"github.com/owncloud/ocis-proxy/pkg/metrics"
+)
+
+// Option defines a single option function.
+type Option func(o *Options)
+
+// Options defines the available options for this package.
+type Options struct {
+	Metrics         *metrics.Metrics
+	CookieSecret    string
+	AccountsService accounts.AccountsService
+}
+
+// newOptions initializes the available default options.
+func newOptions(opts ...Option) Options {
+	opt := Options{}
+
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return opt
+}
+
+// Metrics provides a function to set the metrics option.
+func Metrics(val *metrics.Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = val
+	}
+}
+
+// CookieSecret provides a function to set the secret used to sign cookies.
+func CookieSecret(val string) Option {
+	return func(o *Options) {
+		o.CookieSecret = val
+	}
+}
+
+// AccountsService provides a function to set the accounts service used to look up accounts.
+func AccountsService(val accounts.AccountsService) Option {
+	return func(o *Options) {
+		o.AccountsService = val
+	}
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+// NewRequestSelector selects the policy based on attributes of the request without involving the accounts-service.
+// The rules are evaluated in order, the policy of the first matching rule is selected. Each rule matches exactly one
+// attribute: the host, a path prefix, a header or a cookie. Headers and cookies match when their value equals "value",
+// or when they are present if no value is configured.
+//
+//	"policy_selector": {
+//	   "request": {
+//	     "default_policy": "oc10",
+//	     "rules": [
+//	       {"host": "beta.example.com", "policy": "reva"},
+//	       {"header": "X-Rollout", "value": "reva", "policy": "reva"},
+//	       {"cookie": "owncloud-rollout", "value": "reva", "policy": "reva"},
+//	       {"path": "/ocs/v2.php/apps/beta", "policy": "reva"}
+//	     ]
+//	   }
+//	 },
+func NewRequestSelector(cfg *config.RequestSelectorConf) (Selector, error) {
+	for i, rule := range cfg.Rules {
+		if err := validateRequestCondition(rule.RequestCondition); err != nil {
+			return nil, fmt.Errorf("request rule %d: %w", i, err)
+		}
+		if rule.Policy == "" {
+			return nil, fmt.Errorf("request rule %d: missing policy", i)
+		}
+	}
+
+	return func(ctx context.Context, r *http.Request) (string, error) {
+		for _, rule := range cfg.Rules {
+			if matchRequestCondition(rule.RequestCondition, r) {
+				return rule.Policy, nil
+			}
+		}
+
+		return cfg.DefaultPolicy, nil
+	}, nil
+}
+
+// validateRequestCondition checks that a condition matches exactly one request attribute.
+func validateRequestCondition(rule config.RequestCondition) error {
+	n := 0
+	for _, attr := range []string{rule.Host, rule.Header, rule.Cookie, rule.Path} {
+		if attr != "" {
+			n++
+		}
+	}
+
+	if n != 1 {
+		return fmt.Errorf("exactly one of \"host\", \"header\", \"cookie\" or \"path\" must be set")
+	}
+
+	return nil
+}
+
+// matchRequestCondition reports whether the request matches the condition.
+func matchRequestCondition(rule config.RequestCondition, r *http.Request) bool {
+	switch {
+	case rule.Host != "":
+		return strings.EqualFold(hostname(request.ForwardedFrom(r).Host), rule.Host)
+	case rule.Path != "":
+		return strings.HasPrefix(r.URL.Path, rule.Path)
+	case rule.Header != "":
+		values, ok := r.Header[http.CanonicalHeaderKey(rule.Header)]
+		if !ok {
+			return false
+		}
+		if rule.Value == "" {
+			return true
+		}
+		for _, v := range values {
+			if v == rule.Value {
+				return true
+			}
+		}
+	case rule.Cookie != "":
+		c, err := r.Cookie(rule.Cookie)
+		if err != nil {
+			return false
+		}
+		return rule.Value == "" || c.Value == rule.Value
+	}
+
+	return false
+}
+
+// hostname strips the port from host.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
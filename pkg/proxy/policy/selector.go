@@ -7,15 +7,14 @@ import (
 
 	"github.com/micro/go-micro/v2/client/grpc"
 	accounts "github.com/owncloud/ocis-accounts/pkg/proto/v0"
-	"github.com/owncloud/ocis-pkg/v2/oidc"
 	"github.com/owncloud/ocis-proxy/pkg/config"
 )
 
 var (
 	// ErrMultipleSelectors in case there is more then one selector configured.
-	ErrMultipleSelectors = fmt.Errorf("only one type of policy-selector (static or migration) can be configured")
+	ErrMultipleSelectors = fmt.Errorf("only one type of policy-selector (static, migration, claims, request, canary, chain or expression) can be configured")
 	// ErrSelectorConfigIncomplete if policy_selector conf is missing
-	ErrSelectorConfigIncomplete = fmt.Errorf("missing either \"static\" or \"migration\" configuration in policy_selector config ")
+	ErrSelectorConfigIncomplete = fmt.Errorf("missing either \"static\", \"migration\", \"claims\", \"request\", \"canary\", \"chain\" or \"expression\" configuration in policy_selector config ")
 	// ErrUnexpectedConfigError unexpected config error
 	ErrUnexpectedConfigError = fmt.Errorf("could not initialize policy-selector for given config")
 )
@@ -48,12 +47,13 @@ var (
 type Selector func(ctx context.Context, r *http.Request) (string, error)
 
 // LoadSelector constructs a specific policy-selector from a given configuration
-func LoadSelector(cfg *config.PolicySelector) (Selector, error) {
-	if cfg.Migration != nil && cfg.Static != nil {
-		return nil, ErrMultipleSelectors
-	}
+func LoadSelector(cfg *config.PolicySelector, opts ...Option) (Selector, error) {
+	options := newOptions(opts...)
 
-	if cfg.Migration == nil && cfg.Static == nil {
+	switch configured := countSelectors(cfg); {
+	case configured > 1:
+		return nil, ErrMultipleSelectors
+	case configured == 0:
 		return nil, ErrSelectorConfigIncomplete
 	}
 
@@ -62,14 +62,63 @@ func LoadSelector(cfg *config.PolicySelector) (Selector, error) {
 	}
 
 	if cfg.Migration != nil {
-		return NewMigrationSelector(
-			cfg.Migration,
-			accounts.NewAccountsService("com.owncloud.accounts", grpc.NewClient())), nil
+		accountsService := options.AccountsService
+		if accountsService == nil {
+			accountsService = accounts.NewAccountsService(config.AccountsService, grpc.NewClient())
+		}
+		return NewMigrationSelector(cfg.Migration, accountsService, opts...)
+	}
+
+	if cfg.Claims != nil {
+		return NewClaimsSelector(cfg.Claims)
+	}
+
+	if cfg.Request != nil {
+		return NewRequestSelector(cfg.Request)
+	}
+
+	if cfg.Canary != nil {
+		return NewCanarySelector(cfg.Canary, options.Metrics)
+	}
+
+	if cfg.Chain != nil {
+		return NewChainSelector(cfg.Chain, opts...)
+	}
+
+	if cfg.Expression != nil {
+		return NewExpressionSelector(cfg.Expression)
 	}
 
 	return nil, ErrUnexpectedConfigError
 }
 
+// countSelectors returns how many selectors are configured.
+func countSelectors(cfg *config.PolicySelector) int {
+	n := 0
+	if cfg.Static != nil {
+		n++
+	}
+	if cfg.Migration != nil {
+		n++
+	}
+	if cfg.Claims != nil {
+		n++
+	}
+	if cfg.Request != nil {
+		n++
+	}
+	if cfg.Canary != nil {
+		n++
+	}
+	if cfg.Chain != nil {
+		n++
+	}
+	if cfg.Expression != nil {
+		n++
+	}
+	return n
+}
+
 // NewStaticSelector returns a selector which uses a pre-configured policy.
 //
 // Configuration:
@@ -82,32 +131,3 @@ func NewStaticSelector(cfg *config.StaticSelectorConf) Selector {
 		return cfg.Policy, nil
 	}
 }
-
-// NewMigrationSelector selects the policy based on the existence of the oidc "preferred_username" claim in the accounts-service.
-// The policy for each case is configurable:
-// "policy_selector": {
-//    "migration": {
-//      "acc_found_policy" : "reva",
-//      "acc_not_found_policy": "oc10",
-//      "unauthenticated_policy": "oc10"
-//    }
-//  },
-//
-// This selector can be used in migration-scenarios where some users have already migrated from ownCloud10 to OCIS and
-// thus have an entry in ocis-accounts. All users without accounts entry are routed to the legacy ownCloud10 instance.
-func NewMigrationSelector(cfg *config.MigrationSelectorConf, ss accounts.AccountsService) Selector {
-	var acc = ss
-	return func(ctx context.Context, r *http.Request) (s string, err error) {
-		var userID string
-		if claims := oidc.FromContext(r.Context()); claims != nil {
-			userID = claims.PreferredUsername
-			if _, err := acc.GetAccount(ctx, &accounts.GetAccountRequest{Id: userID}); err != nil {
-				return cfg.AccNotFoundPolicy, nil
-			}
-
-			return cfg.AccFoundPolicy, nil
-		}
-
-		return cfg.UnauthenticatedPolicy, nil
-	}
-}
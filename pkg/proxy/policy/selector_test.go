@@ -1,12 +1,18 @@
 package policy
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/micro/go-micro/v2/client"
+	merrors "github.com/micro/go-micro/v2/errors"
 	"github.com/owncloud/ocis-accounts/pkg/proto/v0"
 	"github.com/owncloud/ocis-pkg/v2/oidc"
 	"github.com/owncloud/ocis-proxy/pkg/config"
@@ -62,7 +68,10 @@ func TestMigrationSelector(t *testing.T) {
 		//t.Run(fmt.Sprintf("#%v", k), func(t *testing.T) {
 		//	t.Parallel()
 		tc := tc
-		sut := NewMigrationSelector(&cfg, mockAccSvc(tc.AccSvcShouldReturnError))
+		sut, err := NewMigrationSelector(&cfg, mockAccSvc(tc.AccSvcShouldReturnError))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
 		r := httptest.NewRequest("GET", "https://example.com", nil)
 		ctx := oidc.NewContext(r.Context(), tc.Claims)
 		nr := r.WithContext(ctx)
@@ -79,19 +88,478 @@ func TestMigrationSelector(t *testing.T) {
 	}
 }
 
+func TestMigrationSelectorAccountsErrors(t *testing.T) {
+	var calls int
+	var accErr error
+	accSvc := &proto.MockAccountsService{
+		ListFunc: func(ctx context.Context, in *proto.ListAccountsRequest, opts ...client.CallOption) (*proto.ListAccountsResponse, error) {
+			calls++
+			if accErr != nil {
+				return nil, accErr
+			}
+			return &proto.ListAccountsResponse{Accounts: []*proto.Account{{}}}, nil
+		},
+	}
+	cfg := config.MigrationSelectorConf{
+		AccFoundPolicy:    "found",
+		AccNotFoundPolicy: "not_found",
+		PositiveCacheTTL:  time.Minute,
+		Cookie:            "policy",
+	}
+
+	selectFor := func(sut Selector, user string, cookies ...*http.Cookie) (string, []*http.Cookie, error) {
+		r := httptest.NewRequest("GET", "https://example.com", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		ctx := NewCookieContext(oidc.NewContext(r.Context(), &oidc.StandardClaims{PreferredUsername: user}))
+		policy, err := sut(ctx, r.WithContext(ctx))
+		return policy, Cookies(ctx), err
+	}
+
+	sut, _ := NewMigrationSelector(&cfg, accSvc, CookieSecret("secret"))
+	policy, cookies, err := selectFor(sut, "einstein")
+	if err != nil || policy != "found" {
+		t.Fatalf("Expected Policy found got %v, %v", policy, err)
+	}
+	if len(cookies) != 1 {
+		t.Fatalf("Expected sticky cookie got %v", cookies)
+	}
+	sticky := cookies[0]
+
+	// cached, the accounts service is not asked again
+	_, _, _ = selectFor(sut, "einstein")
+	if calls != 1 {
+		t.Errorf("Expected 1 call to the accounts service got %v", calls)
+	}
+
+	accErr = merrors.Timeout(config.AccountsService, "timeout")
+
+	// fail closed
+	failClosed, _ := NewMigrationSelector(&cfg, accSvc, CookieSecret("secret"))
+	if _, _, err := selectFor(failClosed, "einstein", sticky); !errors.Is(err, ErrAccountsUnavailable) {
+		t.Errorf("Expected %v got %v", ErrAccountsUnavailable, err)
+	}
+
+	// stick to the last known policy from the cookie
+	cfg.OnError = OnErrorLastKnown
+	lastKnown, _ := NewMigrationSelector(&cfg, accSvc, CookieSecret("secret"))
+	if policy, _, err := selectFor(lastKnown, "einstein", sticky); err != nil || policy != "found" {
+		t.Errorf("Expected Policy found got %v, %v", policy, err)
+	}
+
+	// the cookie is bound to the user
+	if _, _, err := selectFor(lastKnown, "marie", &http.Cookie{Name: "policy", Value: sticky.Value}); !errors.Is(err, ErrAccountsUnavailable) {
+		t.Errorf("Expected %v got %v", ErrAccountsUnavailable, err)
+	}
+}
+
+func TestMigrationSelectorMatch(t *testing.T) {
+	claims := &oidc.StandardClaims{
+		PreferredUsername: "einstein",
+		Email:             "einstein@example.org",
+		OcisID:            "4c510ada-c86b-4815-8820-42cdf82c3d51",
+	}
+
+	var tests = []struct {
+		Claim    string
+		Match    string
+		Expected string
+	}{
+		{"", "", "preferred_name eq 'einstein'"},
+		{"email", MatchEmail, "mail eq 'einstein@example.org'"},
+		{"ocis.id", MatchID, "id eq '4c510ada-c86b-4815-8820-42cdf82c3d51'"},
+	}
+
+	for _, tc := range tests {
+		var query string
+		accSvc := &proto.MockAccountsService{
+			ListFunc: func(ctx context.Context, in *proto.ListAccountsRequest, opts ...client.CallOption) (*proto.ListAccountsResponse, error) {
+				query = in.Query
+				return &proto.ListAccountsResponse{}, nil
+			},
+		}
+
+		sut, err := NewMigrationSelector(&config.MigrationSelectorConf{Claim: tc.Claim, Match: tc.Match}, accSvc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		r := httptest.NewRequest("GET", "https://example.com", nil)
+		ctx := oidc.NewContext(r.Context(), claims)
+		if _, err := sut(ctx, r.WithContext(ctx)); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		if query != tc.Expected {
+			t.Errorf("Expected query %v got %v", tc.Expected, query)
+		}
+	}
+
+	if _, err := NewMigrationSelector(&config.MigrationSelectorConf{Match: "uid"}, &proto.MockAccountsService{}); err == nil {
+		t.Errorf("Expected error for unknown match")
+	}
+}
+
 func mockAccSvc(retErr bool) proto.AccountsService {
 	if retErr {
 		return &proto.MockAccountsService{
-			GetFunc: func(ctx context.Context, in *proto.GetAccountRequest, opts ...client.CallOption) (record *proto.Account, err error) {
-				return nil, fmt.Errorf("error returned by mockAccountsService GET")
+			ListFunc: func(ctx context.Context, in *proto.ListAccountsRequest, opts ...client.CallOption) (*proto.ListAccountsResponse, error) {
+				return &proto.ListAccountsResponse{}, nil
 			},
 		}
 	}
 
 	return &proto.MockAccountsService{
-		GetFunc: func(ctx context.Context, in *proto.GetAccountRequest, opts ...client.CallOption) (record *proto.Account, err error) {
-			return &proto.Account{}, nil
+		ListFunc: func(ctx context.Context, in *proto.ListAccountsRequest, opts ...client.CallOption) (*proto.ListAccountsResponse, error) {
+			return &proto.ListAccountsResponse{Accounts: []*proto.Account{{}}}, nil
+		},
+	}
+
+}
+
+func TestClaimsSelector(t *testing.T) {
+	cfg := config.ClaimsSelectorConf{
+		DefaultPolicy:         "default",
+		UnauthenticatedPolicy: "unauth",
+		Rules: []config.ClaimsSelectorRule{
+			{Claim: "email", Operator: OperatorEndsWith, Value: "@eu.example.com", Policy: "eu-ams-1"},
+			{Claim: "groups", Operator: OperatorContains, Value: "beta", Policy: "reva"},
+			{Claim: "preferred_username", Operator: OperatorRegex, Value: "^admin-", Policy: "admin"},
+			{Claim: "preferred_username", Value: "einstein", Policy: "einstein"},
+		},
+	}
+	sut, err := NewClaimsSelector(&cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		Claims   *oidc.StandardClaims
+		Expected string
+	}{
+		{nil, "unauth"},
+		{&oidc.StandardClaims{Email: "marie@eu.example.com", Groups: []string{"beta"}}, "eu-ams-1"},
+		{&oidc.StandardClaims{Email: "marie@us.example.com", Groups: []string{"users", "beta"}}, "reva"},
+		{&oidc.StandardClaims{Groups: []string{"betatesters"}}, "default"},
+		{&oidc.StandardClaims{PreferredUsername: "admin-marie"}, "admin"},
+		{&oidc.StandardClaims{PreferredUsername: "einstein"}, "einstein"},
+		{&oidc.StandardClaims{PreferredUsername: "einstein2"}, "default"},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", "https://example.com", nil)
+		ctx := oidc.NewContext(r.Context(), tc.Claims)
+
+		got, err := sut(ctx, r.WithContext(ctx))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		if got != tc.Expected {
+			t.Errorf("Expected Policy %v got %v", tc.Expected, got)
+		}
+	}
+}
+
+func TestClaimsSelectorInvalidRules(t *testing.T) {
+	rules := []config.ClaimsSelectorRule{
+		{Claim: "email", Operator: "like", Value: "foo"},
+		{Claim: "email", Operator: OperatorRegex, Value: "("},
+	}
+
+	for _, rule := range rules {
+		if _, err := NewClaimsSelector(&config.ClaimsSelectorConf{Rules: []config.ClaimsSelectorRule{rule}}); err == nil {
+			t.Errorf("Expected error for rule %+v", rule)
+		}
+	}
+}
+
+func TestLoadSelector(t *testing.T) {
+	if _, err := LoadSelector(&config.PolicySelector{}); err != ErrSelectorConfigIncomplete {
+		t.Errorf("Expected %v got %v", ErrSelectorConfigIncomplete, err)
+	}
+
+	_, err := LoadSelector(&config.PolicySelector{
+		Static: &config.StaticSelectorConf{Policy: "reva"},
+		Claims: &config.ClaimsSelectorConf{DefaultPolicy: "reva"},
+	})
+	if err != ErrMultipleSelectors {
+		t.Errorf("Expected %v got %v", ErrMultipleSelectors, err)
+	}
+
+	if _, err := LoadSelector(&config.PolicySelector{Claims: &config.ClaimsSelectorConf{DefaultPolicy: "reva"}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRequestSelector(t *testing.T) {
+	cfg := config.RequestSelectorConf{
+		DefaultPolicy: "oc10",
+		Rules: []config.RequestSelectorRule{
+			{RequestCondition: config.RequestCondition{Host: "beta.example.com"}, Policy: "host"},
+			{RequestCondition: config.RequestCondition{Header: "X-Rollout", Value: "reva"}, Policy: "header"},
+			{RequestCondition: config.RequestCondition{Header: "X-Canary"}, Policy: "header-present"},
+			{RequestCondition: config.RequestCondition{Cookie: "owncloud-rollout", Value: "reva"}, Policy: "cookie"},
+			{RequestCondition: config.RequestCondition{Path: "/ocs/v2.php/apps/beta"}, Policy: "path"},
+		},
+	}
+	sut, err := NewRequestSelector(&cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		URL      string
+		Header   map[string]string
+		Cookie   *http.Cookie
+		Expected string
+	}{
+		{"https://example.com/", nil, nil, "oc10"},
+		{"https://BETA.example.com:9200/", nil, nil, "host"},
+		{"https://example.com/", map[string]string{"X-Rollout": "reva"}, nil, "header"},
+		{"https://example.com/", map[string]string{"X-Rollout": "oc10"}, nil, "oc10"},
+		{"https://example.com/", map[string]string{"x-canary": ""}, nil, "header-present"},
+		{"https://example.com/", nil, &http.Cookie{Name: "owncloud-rollout", Value: "reva"}, "cookie"},
+		{"https://example.com/", nil, &http.Cookie{Name: "owncloud-rollout", Value: "oc10"}, "oc10"},
+		{"https://example.com/ocs/v2.php/apps/beta/foo", nil, nil, "path"},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", tc.URL, nil)
+		for k, v := range tc.Header {
+			r.Header.Set(k, v)
+		}
+		if tc.Cookie != nil {
+			r.AddCookie(tc.Cookie)
+		}
+
+		got, err := sut(r.Context(), r)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		if got != tc.Expected {
+			t.Errorf("%v: Expected Policy %v got %v", tc.URL, tc.Expected, got)
+		}
+	}
+}
+
+func TestRequestSelectorInvalidRules(t *testing.T) {
+	rules := []config.RequestSelectorRule{
+		{Policy: "reva"},
+		{RequestCondition: config.RequestCondition{Host: "example.com", Path: "/"}, Policy: "reva"},
+		{RequestCondition: config.RequestCondition{Host: "example.com"}},
+	}
+
+	for _, rule := range rules {
+		if _, err := NewRequestSelector(&config.RequestSelectorConf{Rules: []config.RequestSelectorRule{rule}}); err == nil {
+			t.Errorf("Expected error for rule %+v", rule)
+		}
+	}
+}
+
+func TestCanarySelector(t *testing.T) {
+	cfg := config.CanarySelectorConf{
+		Policy:                "reva",
+		DefaultPolicy:         "oc10",
+		UnauthenticatedPolicy: "unauth",
+		Percentage:            50,
+		Allow:                 []string{"allowed"},
+		Deny:                  []string{"denied"},
+	}
+	sut, err := NewCanarySelector(&cfg, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	selectFor := func(claims *oidc.StandardClaims) string {
+		r := httptest.NewRequest("GET", "https://example.com", nil)
+		ctx := oidc.NewContext(r.Context(), claims)
+		got, err := sut(ctx, r.WithContext(ctx))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		return got
+	}
+
+	if got := selectFor(nil); got != "unauth" {
+		t.Errorf("Expected Policy unauth got %v", got)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		got := selectFor(&oidc.StandardClaims{PreferredUsername: user})
+		if again := selectFor(&oidc.StandardClaims{PreferredUsername: user}); again != got {
+			t.Errorf("Expected stable assignment for %v, got %v and %v", user, got, again)
+		}
+		counts[got]++
+	}
+	if counts["reva"] < 400 || counts["reva"] > 600 {
+		t.Errorf("Expected about half of the users on the canary, got %v", counts)
+	}
+
+	for _, percentage := range []int{0, 100} {
+		cfg.Percentage = percentage
+		sut, _ = NewCanarySelector(&cfg, nil)
+		got := selectFor(&oidc.StandardClaims{PreferredUsername: "allowed"})
+		if got != "reva" {
+			t.Errorf("Expected allowed user on canary with %d%%, got %v", percentage, got)
+		}
+		got = selectFor(&oidc.StandardClaims{PreferredUsername: "denied"})
+		if got != "oc10" {
+			t.Errorf("Expected denied user on default with %d%%, got %v", percentage, got)
+		}
+	}
+
+	cfg.Percentage = 101
+	if _, err := NewCanarySelector(&cfg, nil); err == nil {
+		t.Errorf("Expected error for percentage %v", cfg.Percentage)
+	}
+}
+
+func TestChainSelector(t *testing.T) {
+	cfg := config.PolicySelector{
+		Chain: &config.ChainSelectorConf{
+			DefaultPolicy: "default",
+			Selectors: []config.ChainSelectorStep{
+				{
+					When:     &config.RequestCondition{Host: "legacy.example.com"},
+					Selector: config.PolicySelector{Static: &config.StaticSelectorConf{Policy: "oc10"}},
+				},
+				{
+					Selector: config.PolicySelector{Claims: &config.ClaimsSelectorConf{
+						Rules: []config.ClaimsSelectorRule{{Claim: "groups", Operator: OperatorContains, Value: "beta", Policy: "reva"}},
+					}},
+				},
+				{
+					When: &config.RequestCondition{Path: "/ocs/"},
+					Selector: config.PolicySelector{Chain: &config.ChainSelectorConf{
+						DefaultPolicy: "ocs",
+					}},
+				},
+			},
 		},
 	}
+	sut, err := LoadSelector(&cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		URL      string
+		Claims   *oidc.StandardClaims
+		Expected string
+	}{
+		{"https://legacy.example.com/", &oidc.StandardClaims{Groups: []string{"beta"}}, "oc10"},
+		{"https://example.com/", &oidc.StandardClaims{Groups: []string{"beta"}}, "reva"},
+		{"https://example.com/ocs/v1.php", &oidc.StandardClaims{}, "ocs"},
+		{"https://example.com/", nil, "default"},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", tc.URL, nil)
+		ctx := oidc.NewContext(r.Context(), tc.Claims)
 
+		got, err := sut(ctx, r.WithContext(ctx))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		if got != tc.Expected {
+			t.Errorf("%v: Expected Policy %v got %v", tc.URL, tc.Expected, got)
+		}
+	}
+
+	cfg.Chain.Selectors[0].Selector.Claims = &config.ClaimsSelectorConf{}
+	if _, err := LoadSelector(&cfg); !errors.Is(err, ErrMultipleSelectors) {
+		t.Errorf("Expected %v got %v", ErrMultipleSelectors, err)
+	}
+}
+
+func TestExpressionSelector(t *testing.T) {
+	sut, err := LoadSelector(&config.PolicySelector{Expression: &config.ExpressionSelectorConf{
+		Expression: `host == "legacy.example.com" ? "oc10" : ("beta" in claims.groups ? "reva" : "oc10")`,
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		URL      string
+		Claims   *oidc.StandardClaims
+		Expected string
+	}{
+		{"https://legacy.example.com/", &oidc.StandardClaims{Groups: []string{"beta"}}, "oc10"},
+		{"https://example.com/", &oidc.StandardClaims{Groups: []string{"beta"}}, "reva"},
+		{"https://example.com/", &oidc.StandardClaims{Groups: []string{"users"}}, "oc10"},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", tc.URL, nil)
+		ctx := oidc.NewContext(r.Context(), tc.Claims)
+
+		got, err := sut(ctx, r.WithContext(ctx))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		if got != tc.Expected {
+			t.Errorf("%v: Expected Policy %v got %v", tc.URL, tc.Expected, got)
+		}
+	}
+}
+
+func TestExpressionSelectorInvalidExpressions(t *testing.T) {
+	expressions := []string{
+		`host ==`,
+		`hostname == "example.com" ? "reva" : "oc10"`,
+		`method == "GET"`,
+		`len(path)`,
+	}
+
+	for _, e := range expressions {
+		if _, err := NewExpressionSelector(&config.ExpressionSelectorConf{Expression: e}); err == nil {
+			t.Errorf("Expected error for expression %v", e)
+		}
+	}
+}
+
+func TestEvalExpression(t *testing.T) {
+	recorded := "PROPFIND /remote.php/dav/files/einstein/ HTTP/1.1\r\n" +
+		"Host: cloud.example.com:9200\r\n" +
+		"X-Rollout: reva\r\n" +
+		"Cookie: owncloud-rollout=beta\r\n" +
+		"\r\n"
+
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(recorded)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r = r.WithContext(oidc.NewContext(r.Context(), &oidc.StandardClaims{Email: "einstein@eu.example.com"}))
+
+	var tests = []struct {
+		Expression string
+		Expected   string
+	}{
+		{`method`, "PROPFIND"},
+		{`host`, "cloud.example.com"},
+		{`path startsWith "/remote.php/dav/files/" ? "reva" : "oc10"`, "reva"},
+		{`headers["X-Rollout"]`, "reva"},
+		{`cookies["owncloud-rollout"] == "beta" ? "beta" : ""`, "beta"},
+		{`authenticated && claims.email endsWith "@eu.example.com" ? "eu-ams-1" : "us-east-1"`, "eu-ams-1"},
+		{`claims.preferred_username`, ""},
+	}
+
+	for _, tc := range tests {
+		got, err := EvalExpression(tc.Expression, r)
+		if err != nil {
+			t.Errorf("%v: Unexpected error: %v", tc.Expression, err)
+		}
+
+		if got != tc.Expected {
+			t.Errorf("%v: Expected Policy %v got %v", tc.Expression, tc.Expected, got)
+		}
+	}
 }
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -9,11 +10,14 @@ import (
 	"strings"
 
 	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
-	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"github.com/owncloud/ocis-proxy/pkg/tracing"
+	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/trace"
 
 	"github.com/owncloud/ocis-pkg/v2/log"
 	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/metrics"
 )
 
 // MultiHostReverseProxy extends httputil to support multiple hosts with diffent policies
@@ -22,8 +26,8 @@ type MultiHostReverseProxy struct {
 	Directors      map[string]map[config.RouteType]map[string]func(req *http.Request)
 	PolicySelector policy.Selector
 	logger         log.Logger
-	propagator     tracecontext.HTTPFormat
 	config         *config.Config
+	metrics        *metrics.Metrics
 }
 
 // NewMultiHostReverseProxy undocummented
@@ -34,12 +38,17 @@ func NewMultiHostReverseProxy(opts ...Option) *MultiHostReverseProxy {
 		Directors: make(map[string]map[config.RouteType]map[string]func(req *http.Request)),
 		logger:    options.Logger,
 		config:    options.Config,
+		metrics:   options.Metrics,
 	}
 	rp.Director = rp.directorSelectionDirector
+	rp.ErrorHandler = rp.errorHandler
+	rp.ModifyResponse = rp.modifyResponse
+	upstream := newTransport()
+	rp.Transport = upstream
 
 	if options.Config.Policies == nil {
 		rp.logger.Info().Str("source", "runtime").Msg("Policies")
-		options.Config.Policies = defaultPolicies()
+		options.Config.Policies = config.DefaultPolicies()
 	} else {
 		rp.logger.Info().Str("source", "file").Msg("Policies")
 	}
@@ -58,7 +67,11 @@ func NewMultiHostReverseProxy(opts ...Option) *MultiHostReverseProxy {
 		Interface("selector_config", options.Config.PolicySelector).
 		Msg("loading policy-selector")
 
-	policySelector, err := policy.LoadSelector(options.Config.PolicySelector)
+	policySelector, err := policy.LoadSelector(
+		options.Config.PolicySelector,
+		policy.Metrics(options.Metrics),
+		policy.CookieSecret(options.Config.TokenManager.JWTSecret),
+	)
 	if err != nil {
 		rp.logger.Fatal().Err(err).Msg("Could not load policy-selector")
 	}
@@ -82,26 +95,53 @@ func NewMultiHostReverseProxy(opts ...Option) *MultiHostReverseProxy {
 				Msg("adding route")
 
 			rp.AddHost(pol.Name, uri, route)
+			if route.HTTP2 && uri.Scheme == "http" {
+				upstream.addH2CHost(uri.Host)
+			}
 		}
 	}
 
 	return rp
 }
 
+type directorKey struct{}
+
+// directorSelectionDirector applies the director that was selected for the request in ServeHTTP.
 func (p *MultiHostReverseProxy) directorSelectionDirector(r *http.Request) {
-	pol, err := p.PolicySelector(r.Context(), r)
-	if err != nil {
-		p.logger.Error().Msgf("Error while selecting pol %v", err)
-		return
+	if director, ok := r.Context().Value(directorKey{}).(func(req *http.Request)); ok {
+		director(r)
+	}
+
+	if p.config.Tracing.Enabled {
+		tracing.Propagate(r.Context(), r)
+	}
+}
+
+// selectDirector finds the director of the policy selected for the request. The policy is taken from the request
+// context when the SelectPolicy middleware ran, otherwise the policy-selector is called.
+func (p *MultiHostReverseProxy) selectDirector(r *http.Request) (func(req *http.Request), error) {
+	l := request.Logger(r.Context(), p.logger)
+	pol, ok := policy.FromContext(r.Context())
+	if !ok {
+		var err error
+		if pol, err = p.PolicySelector(r.Context(), r); err != nil {
+			l.Error().Msgf("Error while selecting pol %v", err)
+			return nil, fmt.Errorf("%w: %v", ErrPolicySelection, err)
+		}
 	}
 
 	if _, ok := p.Directors[pol]; !ok {
-		p.logger.
+		l.
 			Error().
 			Msgf("policy %v is not configured", pol)
-		return
+		return nil, fmt.Errorf("%w: %v", ErrUnknownPolicy, pol)
 	}
 
+	if info := request.InfoFromContext(r.Context()); info != nil {
+		info.Policy = pol
+	}
+	trace.FromContext(r.Context()).AddAttributes(trace.StringAttribute("policy", pol))
+
 	// find matching director
 	for _, rt := range config.RouteTypes {
 		var handler func(string, url.URL) bool
@@ -117,30 +157,40 @@ func (p *MultiHostReverseProxy) directorSelectionDirector(r *http.Request) {
 		}
 		for endpoint := range p.Directors[pol][rt] {
 			if handler(endpoint, *r.URL) {
-				p.logger.
+				l.
 					Debug().
 					Str("policy", pol).
 					Str("prefix", endpoint).
 					Str("path", r.URL.Path).
 					Str("routeType", string(rt)).
 					Msg("director found")
-				p.Directors[pol][rt][endpoint](r)
-				return
+				return p.Directors[pol][rt][endpoint], nil
 			}
 		}
 	}
 
 	// override default director with root. If any
 	if p.Directors[pol][config.PrefixRoute]["/"] != nil {
-		p.Directors[pol][config.PrefixRoute]["/"](r)
-		return
+		return p.Directors[pol][config.PrefixRoute]["/"], nil
 	}
 
-	p.logger.
+	l.
 		Warn().
 		Str("policy", pol).
 		Str("path", r.URL.Path).
 		Msg("no director found")
+	return nil, ErrNoRoute
+}
+
+// headerEnv returns the variables of the header templates. Without them the templates fail and the rules are
+// skipped.
+func (p *MultiHostReverseProxy) headerEnv(r *http.Request) map[string]interface{} {
+	env, err := policy.RequestEnv(r.Context(), r)
+	if err != nil {
+		l := request.Logger(r.Context(), p.logger)
+		l.Error().Err(err).Msg("could not get the variables of the header templates")
+	}
+	return env
 }
 
 func singleJoiningSlash(a, b string) string {
@@ -168,13 +218,48 @@ func (p *MultiHostReverseProxy) AddHost(policy string, target *url.URL, rt confi
 	if p.Directors[policy][routeType] == nil {
 		p.Directors[policy][routeType] = make(map[string]func(req *http.Request))
 	}
+	requestRules, err := parseHeaderRules(rt.RequestHeaders)
+	if err != nil {
+		p.logger.Fatal().Err(err).Str("route", rt.Endpoint).Msg("invalid request header rule")
+	}
+	responseRules, err := parseHeaderRules(rt.ResponseHeaders)
+	if err != nil {
+		p.logger.Fatal().Err(err).Str("route", rt.Endpoint).Msg("invalid response header rule")
+	}
 	p.Directors[policy][routeType][rt.Endpoint] = func(req *http.Request) {
+		if info := request.InfoFromContext(req.Context()); info != nil {
+			info.RouteType = string(routeType)
+			info.Endpoint = rt.Endpoint
+			info.Backend = target.String()
+		}
+		trace.FromContext(req.Context()).AddAttributes(
+			trace.StringAttribute("route_type", string(routeType)),
+			trace.StringAttribute("route", rt.Endpoint),
+			trace.StringAttribute("backend", target.String()),
+		)
+
+		// the templates see the request as sent by the client
+		var env map[string]interface{}
+		if len(requestRules) > 0 || len(responseRules) > 0 {
+			env = p.headerEnv(req)
+		}
+		f := request.ForwardedFrom(req)
+
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
 		// Apache deployments host addresses need to match on req.Host and req.URL.Host
 		// see https://stackoverflow.com/questions/34745654/golang-reverseproxy-with-apache2-sni-hostname-error
-		if rt.ApacheVHost {
+		switch {
+		case rt.ApacheVHost:
 			req.Host = target.Host
+		case rt.PreserveHost:
+			req.Host = f.Host
+		}
+		setForwardedHeaders(req, f, rt)
+		applyHeaderRules(req.Header, requestRules, env)
+		omitXForwardedFor(req, rt)
+		if rr := responseRulesFromContext(req.Context()); rr != nil {
+			rr.rules, rr.env = responseRules, env
 		}
 
 		req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
@@ -191,20 +276,54 @@ func (p *MultiHostReverseProxy) AddHost(policy string, target *url.URL, rt confi
 }
 
 func (p *MultiHostReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	var span *trace.Span
+	ctx := r.Context()
+
+	// Start root span, unless the tracing middleware already did.
+	if p.config.Tracing.Enabled && trace.FromContext(ctx) == nil {
+		var span *trace.Span
+		ctx, span = tracing.StartServerSpan(r, r.URL.String())
+		defer span.End()
+		span.AddAttributes(trace.StringAttribute("request_id", request.IDFromContext(ctx)))
+	}
+
+	ctx = policy.NewCookieContext(ctx)
+	director, err := p.selectDirector(r.WithContext(ctx))
+	for _, c := range policy.Cookies(ctx) {
+		http.SetCookie(w, c)
+	}
+	if err != nil {
+		p.errorHandler(w, r.WithContext(ctx), err)
+		return
+	}
 
-	// Start root span.
 	if p.config.Tracing.Enabled {
-		ctx, span = trace.StartSpan(context.Background(), r.URL.String())
+		var span *trace.Span
+		ctx, span = trace.StartSpan(ctx, "proxy.upstream", trace.WithSpanKind(trace.SpanKindClient))
 		defer span.End()
-		p.propagator.SpanContextToRequest(span.SpanContext(), r)
 	}
 
 	// Call upstream ServeHTTP
+	ctx = newResponseRulesContext(newXForwardedForContext(context.WithValue(ctx, directorKey{}, director)))
 	p.ReverseProxy.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// modifyResponse applies the response header rules of the route and annotates the upstream span with the response
+// of the backend.
+func (p *MultiHostReverseProxy) modifyResponse(res *http.Response) error {
+	if res.Request == nil {
+		return nil
+	}
+
+	if rr := responseRulesFromContext(res.Request.Context()); rr != nil {
+		applyHeaderRules(res.Header, rr.rules, rr.env)
+	}
+
+	span := trace.FromContext(res.Request.Context())
+	span.AddAttributes(trace.Int64Attribute("http.status_code", int64(res.StatusCode)))
+	span.SetStatus(ochttp.TraceStatus(res.StatusCode, res.Status))
+	return nil
+}
+
 func (p MultiHostReverseProxy) queryRouteMatcher(endpoint string, target url.URL) bool {
 	u, _ := url.Parse(endpoint)
 	if strings.HasPrefix(target.Path, u.Path) && endpoint != "/" {
@@ -237,149 +356,3 @@ func (p *MultiHostReverseProxy) regexRouteMatcher(endpoint string, target url.UR
 func (p *MultiHostReverseProxy) prefixRouteMatcher(endpoint string, target url.URL) bool {
 	return strings.HasPrefix(target.Path, endpoint) && endpoint != "/"
 }
-
-func defaultPolicies() []config.Policy {
-	return []config.Policy{
-		{
-			Name: "reva",
-			Routes: []config.Route{
-				{
-					Endpoint: "/",
-					Backend:  "http://localhost:9100",
-				},
-				{
-					Endpoint: "/.well-known/",
-					Backend:  "http://localhost:9130",
-				},
-				{
-					Endpoint: "/konnect/",
-					Backend:  "http://localhost:9130",
-				},
-				{
-					Endpoint: "/signin/",
-					Backend:  "http://localhost:9130",
-				},
-				{
-					Type:     config.RegexRoute,
-					Endpoint: "/ocs/v[12].php/cloud/user", // we have `user` and `users` in ocis-ocs
-					Backend:  "http://localhost:9110",
-				},
-				{
-					Endpoint: "/ocs/",
-					Backend:  "http://localhost:9140",
-				},
-				{
-					Type:     config.QueryRoute,
-					Endpoint: "/remote.php/?preview=1",
-					Backend:  "http://localhost:9115",
-				},
-				{
-					Endpoint: "/remote.php/",
-					Backend:  "http://localhost:9140",
-				},
-				{
-					Endpoint: "/dav/",
-					Backend:  "http://localhost:9140",
-				},
-				{
-					Endpoint: "/webdav/",
-					Backend:  "http://localhost:9140",
-				},
-				{
-					Endpoint: "/status.php",
-					Backend:  "http://localhost:9140",
-				},
-				{
-					Endpoint: "/index.php/",
-					Backend:  "http://localhost:9140",
-				},
-				{
-					Endpoint: "/data",
-					Backend:  "http://localhost:9140",
-				},
-				// if we were using the go micro api gateway we could look up the endpoint in the registry dynamically
-				{
-					Endpoint: "/api/v0/accounts",
-					Backend:  "http://localhost:9181",
-				},
-				// TODO the lookup needs a better mechanism
-				{
-					Endpoint: "/accounts.js",
-					Backend:  "http://localhost:9181",
-				},
-				{
-					Endpoint: "/api/v0/settings",
-					Backend:  "http://localhost:9190",
-				},
-				{
-					Endpoint: "/settings.js",
-					Backend:  "http://localhost:9190",
-				},
-				{
-					Endpoint: "/api/v0/greet",
-					Backend:  "http://localhost:9105",
-				},
-				{
-					Endpoint: "/hello.js",
-					Backend:  "http://localhost:9105",
-				},
-			},
-		},
-		{
-			Name: "oc10",
-			Routes: []config.Route{
-				{
-					Endpoint: "/",
-					Backend:  "http://localhost:9100",
-				},
-				{
-					Endpoint: "/.well-known/",
-					Backend:  "http://localhost:9130",
-				},
-				{
-					Endpoint: "/konnect/",
-					Backend:  "http://localhost:9130",
-				},
-				{
-					Endpoint: "/signin/",
-					Backend:  "http://localhost:9130",
-				},
-				{
-					Endpoint:    "/ocs/",
-					Backend:     "https://demo.owncloud.com",
-					ApacheVHost: true,
-				},
-				{
-					Endpoint:    "/remote.php/",
-					Backend:     "https://demo.owncloud.com",
-					ApacheVHost: true,
-				},
-				{
-					Endpoint:    "/dav/",
-					Backend:     "https://demo.owncloud.com",
-					ApacheVHost: true,
-				},
-				{
-					Endpoint:    "/webdav/",
-					Backend:     "https://demo.owncloud.com",
-					ApacheVHost: true,
-				},
-				{
-					Endpoint:    "/status.php",
-					Backend:     "https://demo.owncloud.com",
-					ApacheVHost: true,
-				},
-				{
-					Endpoint:    "/index.php/",
-					Backend:     "https://demo.owncloud.com",
-					ApacheVHost: true,
-				},
-				{
-					Endpoint:    "/data",
-					Backend:     "https://demo.owncloud.com",
-					ApacheVHost: true,
-				},
-			},
-		},
-	}
-}
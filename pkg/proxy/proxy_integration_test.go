@@ -2,15 +2,26 @@ package proxy
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/coreos/go-oidc"
+	"github.com/justinas/alice"
+	"github.com/micro/go-micro/v2/client"
+	accounts "github.com/owncloud/ocis-accounts/pkg/proto/v0"
+	ocislog "github.com/owncloud/ocis-pkg/v2/log"
 	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/middleware"
+	"github.com/owncloud/ocis-proxy/pkg/proxy/policy"
+	settings "github.com/owncloud/ocis-settings/pkg/proto/v0"
 )
 
 func TestProxyIntegration(t *testing.T) {
@@ -155,6 +166,236 @@ func TestProxyIntegration(t *testing.T) {
 	}
 }
 
+func TestProxyIntegrationAuthenticatedPolicySelection(t *testing.T) {
+	idp := newTestIDP(map[string]string{
+		"einstein-token": `{"sub": "1", "preferred_username": "einstein"}`,
+		"marie-token":    `{"sub": "2", "preferred_username": "marie"}`,
+	})
+	defer idp.Close()
+
+	accountsService := &accounts.MockAccountsService{
+		ListFunc: func(ctx context.Context, in *accounts.ListAccountsRequest, opts ...client.CallOption) (*accounts.ListAccountsResponse, error) {
+			if in.Query == "preferred_name eq 'einstein'" {
+				return &accounts.ListAccountsResponse{Accounts: []*accounts.Account{{Id: "einstein"}}}, nil
+			}
+			return &accounts.ListAccountsResponse{}, nil
+		},
+	}
+
+	// without the policy from the SelectPolicy middleware the proxy would fall back to the first policy
+	cfg := testConfig([]config.Policy{
+		withPolicy("oc10", withRoutes{{Type: config.PrefixRoute, Endpoint: "/", Backend: "http://oc10"}}),
+		withPolicy("reva", withRoutes{{Type: config.PrefixRoute, Endpoint: "/", Backend: "http://reva"}}),
+	})
+
+	var backend string
+	rp := newTestProxy(cfg, func(req *http.Request) *http.Response {
+		backend = req.URL.Host
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`OK`)),
+			Header:     make(http.Header),
+		}
+	})
+
+	selector, err := policy.NewMigrationSelector(&config.MigrationSelectorConf{
+		AccFoundPolicy:        "reva",
+		AccNotFoundPolicy:     "oc10",
+		UnauthenticatedPolicy: "oc10",
+	}, accountsService)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	logger := ocislog.NewLogger()
+	handler := alice.New(
+		middleware.RequestID,
+		middleware.OpenIDConnect(
+			middleware.Logger(logger),
+			middleware.HTTPClient(http.DefaultClient),
+			middleware.OIDCProviderFunc(func() (middleware.OIDCProvider, error) {
+				return oidc.NewProvider(context.Background(), idp.URL)
+			}),
+		),
+		middleware.SelectPolicy(
+			middleware.Logger(logger),
+			middleware.PolicySelector(selector),
+		),
+	).Then(rp)
+
+	var tests = []struct {
+		token   string
+		status  int
+		backend string
+	}{
+		{"einstein-token", http.StatusOK, "reva"},
+		{"marie-token", http.StatusOK, "oc10"},
+		{"", http.StatusOK, "oc10"},
+		{"invalid-token", http.StatusUnauthorized, ""},
+	}
+
+	for _, tc := range tests {
+		backend = ""
+		r := httptest.NewRequest("GET", "https://example.com/remote.php/webdav/", nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		if rr.Code != tc.status {
+			t.Errorf("%v: Expected status %v got %v", tc.token, tc.status, rr.Code)
+		}
+
+		if backend != tc.backend {
+			t.Errorf("%v: Expected request to be proxied to %v got %v", tc.token, tc.backend, backend)
+		}
+	}
+}
+
+func TestProxyIntegrationNoProvisioningBeforeMigration(t *testing.T) {
+	idp := newTestIDP(map[string]string{
+		"einstein-token": `{"sub": "1", "preferred_username": "einstein", "email": "einstein@example.com"}`,
+		"marie-token":    `{"sub": "2", "preferred_username": "marie", "email": "marie@example.com"}`,
+	})
+	defer idp.Close()
+
+	// einstein has been migrated, marie not yet
+	existing := map[string]bool{"preferred_name eq 'einstein'": true, "mail eq 'einstein@example.com'": true}
+	var created []string
+	accountsService := &accounts.MockAccountsService{
+		ListFunc: func(ctx context.Context, in *accounts.ListAccountsRequest, opts ...client.CallOption) (*accounts.ListAccountsResponse, error) {
+			if existing[in.Query] {
+				return &accounts.ListAccountsResponse{Accounts: []*accounts.Account{{Id: "einstein", AccountEnabled: true}}}, nil
+			}
+			return &accounts.ListAccountsResponse{}, nil
+		},
+		CreateFunc: func(ctx context.Context, in *accounts.CreateAccountRequest, opts ...client.CallOption) (*accounts.Account, error) {
+			created = append(created, in.Account.PreferredName)
+			existing["preferred_name eq '"+in.Account.PreferredName+"'"] = true
+			existing["mail eq '"+in.Account.Mail+"'"] = true
+			return &accounts.Account{Id: in.Account.PreferredName, AccountEnabled: true}, nil
+		},
+	}
+	rolesService := &settings.MockRoleService{
+		ListRoleAssignmentsFunc: func(ctx context.Context, req *settings.ListRoleAssignmentsRequest, opts ...client.CallOption) (*settings.ListRoleAssignmentsResponse, error) {
+			return &settings.ListRoleAssignmentsResponse{}, nil
+		},
+	}
+
+	cfg := testConfig([]config.Policy{
+		withPolicy("oc10", withRoutes{{Type: config.PrefixRoute, Endpoint: "/", Backend: "http://oc10"}}),
+		withPolicy("reva", withRoutes{{Type: config.PrefixRoute, Endpoint: "/", Backend: "http://reva"}}),
+	})
+	cfg.PolicySelector = &config.PolicySelector{Migration: &config.MigrationSelectorConf{
+		AccFoundPolicy:        "reva",
+		AccNotFoundPolicy:     "oc10",
+		UnauthenticatedPolicy: "oc10",
+	}}
+
+	var backend, token string
+	rp := newTestProxy(cfg, func(req *http.Request) *http.Response {
+		backend, token = req.URL.Host, req.Header.Get("x-access-token")
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`OK`)),
+			Header:     make(http.Header),
+		}
+	})
+
+	selector, err := policy.LoadSelector(cfg.PolicySelector, policy.AccountsService(accountsService))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	logger := ocislog.NewLogger()
+	handler := alice.New(
+		middleware.RequestID,
+		middleware.OpenIDConnect(
+			middleware.Logger(logger),
+			middleware.HTTPClient(http.DefaultClient),
+			middleware.OIDCProviderFunc(func() (middleware.OIDCProvider, error) {
+				return oidc.NewProvider(context.Background(), idp.URL)
+			}),
+		),
+		middleware.SelectPolicy(
+			middleware.Logger(logger),
+			middleware.PolicySelector(selector),
+		),
+		middleware.AccountUUID(
+			middleware.Logger(logger),
+			middleware.TokenManagerConfig(config.TokenManager{JWTSecret: "secret"}),
+			middleware.AccountsClient(accountsService),
+			middleware.SettingsRoleService(rolesService),
+			middleware.NoProvisioningPolicies(policy.NotMigratedPolicies(cfg.PolicySelector)),
+		),
+	).Then(rp)
+
+	var tests = []struct {
+		token   string
+		backend string
+		minted  bool
+	}{
+		{"einstein-token", "reva", true},
+		// the account of marie is not created, so she stays on oc10
+		{"marie-token", "oc10", false},
+		{"marie-token", "oc10", false},
+	}
+
+	for _, tc := range tests {
+		backend, token = "", ""
+		r := httptest.NewRequest("GET", "https://example.com/remote.php/webdav/", nil)
+		r.Header.Set("Authorization", "Bearer "+tc.token)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%v: Expected status %v got %v", tc.token, http.StatusOK, rr.Code)
+		}
+		if backend != tc.backend {
+			t.Errorf("%v: Expected request to be proxied to %v got %v", tc.token, tc.backend, backend)
+		}
+		if (token != "") != tc.minted {
+			t.Errorf("%v: Expected an access token %v got %q", tc.token, tc.minted, token)
+		}
+	}
+
+	if len(created) != 0 {
+		t.Errorf("Expected no accounts to be created got %v", created)
+	}
+}
+
+// newTestIDP starts an oidc provider which returns the userinfo claims for the given access tokens.
+func newTestIDP(userinfo map[string]string) *httptest.Server {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := userinfo[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, claims)
+	})
+
+	return srv
+}
+
 func newTestProxy(cfg *config.Config, fn RoundTripFunc) *MultiHostReverseProxy {
 	rp := NewMultiHostReverseProxy(Config(cfg))
 	rp.Transport = fn
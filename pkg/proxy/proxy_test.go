@@ -1,10 +1,21 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
+	"github.com/owncloud/ocis-pkg/v2/oidc"
 	"github.com/owncloud/ocis-proxy/pkg/config"
+	"github.com/owncloud/ocis-proxy/pkg/request"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func TestPrefixRouteMatcher(t *testing.T) {
@@ -110,3 +121,301 @@ func TestRegexRouteMatcherWithInvalidPattern(t *testing.T) {
 		t.Errorf("Endpoint %s and URL %s should not match", endpoint, u.String())
 	}
 }
+
+func TestNoRouteReturnsNotFound(t *testing.T) {
+	cfg := testConfig([]config.Policy{
+		{Name: "reva", Routes: []config.Route{{Endpoint: "/api", Backend: "http://api.example.com"}}},
+	})
+	p := NewMultiHostReverseProxy(Config(cfg))
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/unknown", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{ErrNoRoute, http.StatusNotFound},
+		{fmt.Errorf("%w: foo", ErrUnknownPolicy), http.StatusServiceUnavailable},
+		{fmt.Errorf("%w: foo", ErrPolicySelection), http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{fmt.Errorf("read: %w", context.Canceled), statusClientClosedRequest},
+		{errors.New("connection reset by peer"), http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		if status, _ := errorStatus(tt.err); status != tt.status {
+			t.Errorf("with %v expected status %d got %d", tt.err, tt.status, status)
+		}
+	}
+}
+
+func TestClientClosedRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg := testConfig([]config.Policy{
+		{Name: "reva", Routes: []config.Route{{Endpoint: "/", Backend: backend.URL}}},
+	})
+	p := NewMultiHostReverseProxy(Config(cfg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != statusClientClosedRequest {
+		t.Errorf("Expected status %d got %d", statusClientClosedRequest, w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no error page got %q", w.Body.String())
+	}
+}
+
+func TestServeHTTPKeepsRequestContext(t *testing.T) {
+	cfg := testConfig([]config.Policy{
+		{Name: "reva", Routes: []config.Route{{Endpoint: "/", Backend: "http://backend"}}},
+	})
+	p := newTestProxy(cfg, func(req *http.Request) *http.Response {
+		if oidc.FromContext(req.Context()) == nil {
+			t.Errorf("Expected the claims to be available when proxying the request")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(`OK`)), Header: make(http.Header)}
+	})
+	p.PolicySelector = func(ctx context.Context, r *http.Request) (string, error) {
+		if oidc.FromContext(ctx) == nil {
+			t.Errorf("Expected the claims to be available to the policy selector")
+		}
+		return "reva", nil
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	r = r.WithContext(oidc.NewContext(r.Context(), &oidc.StandardClaims{PreferredUsername: "einstein"}))
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	cfg := testConfig([]config.Policy{
+		{Name: "oc10", Routes: []config.Route{
+			{Endpoint: "/", Backend: "http://oc10.example.com/owncloud"},
+		}},
+		{Name: "reva", Routes: []config.Route{
+			{Type: config.RegexRoute, Endpoint: `\/user\/(\d+)`, Backend: "http://users.example.com", ApacheVHost: true},
+			{Endpoint: "/api", Backend: "http://api.example.com"},
+		}},
+	})
+	cfg.PolicySelector = &config.PolicySelector{Request: &config.RequestSelectorConf{
+		DefaultPolicy: "oc10",
+		Rules: []config.RequestSelectorRule{
+			{RequestCondition: config.RequestCondition{Header: "X-Rollout", Value: "reva"}, Policy: "reva"},
+		},
+	}}
+	p := NewMultiHostReverseProxy(Config(cfg))
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/user/1234?format=json", nil)
+	r.Header.Set("X-Rollout", "reva")
+	got, err := p.Explain(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := &Explanation{
+		Policy:    "reva",
+		RouteType: string(config.RegexRoute),
+		Endpoint:  `\/user\/(\d+)`,
+		Backend:   "http://users.example.com",
+		Upstream:  "http://users.example.com/user/1234?format=json",
+		Host:      "users.example.com",
+	}
+	if *got != *want {
+		t.Errorf("Expected %+v got %+v", want, got)
+	}
+
+	got, err = p.Explain(httptest.NewRequest(http.MethodGet, "https://example.com/status.php", nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Policy != "oc10" || got.Upstream != "http://oc10.example.com/owncloud/status.php" {
+		t.Errorf("Unexpected explanation %+v", got)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "https://example.com/unknown", nil)
+	r.Header.Set("X-Rollout", "reva")
+	if _, err := p.Explain(r); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("Expected %v got %v", ErrNoRoute, err)
+	}
+
+	if routes := p.Routes(); len(routes) != 3 || routes[1].Type != config.RegexRoute || routes[2].Type != config.PrefixRoute {
+		t.Errorf("Unexpected route table %+v", routes)
+	}
+}
+
+func TestUpstreamHTTP2(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	tests := []struct {
+		http2 bool
+		proto string
+	}{
+		{http2: false, proto: "HTTP/1.1"},
+		{http2: true, proto: "HTTP/2.0"},
+	}
+
+	for _, tt := range tests {
+		cfg := testConfig([]config.Policy{
+			{Name: "reva", Routes: []config.Route{{Endpoint: "/", Backend: backend.URL, HTTP2: tt.http2}}},
+		})
+		p := NewMultiHostReverseProxy(Config(cfg))
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+
+		if w.Code != http.StatusOK || w.Body.String() != tt.proto {
+			t.Errorf("Expected %s to the backend got %d %s", tt.proto, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s|%s|%s|%s", r.Host, r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Proto"),
+			r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Prefix"), r.Header.Get("Forwarded"))
+	}))
+	defer backend.Close()
+
+	proxied := request.Forwarded{For: "2001:db8::1", Proto: "https", Host: "cloud.example.com", Proxied: true}
+
+	tests := []struct {
+		name      string
+		route     config.Route
+		forwarded *request.Forwarded
+		expected  string
+	}{
+		{
+			name:     "spoofed headers are replaced",
+			route:    config.Route{},
+			expected: "example.com|192.0.2.1|http|example.com||",
+		},
+		{
+			name:      "trusted proxy",
+			route:     config.Route{ForwardedPrefix: "/dav"},
+			forwarded: &proxied,
+			expected:  "example.com|2001:db8::1, 192.0.2.1|https|cloud.example.com|/dav|",
+		},
+		{
+			name:      "forwarded and preserved host",
+			route:     config.Route{Forwarded: config.ForwardedRFC7239, PreserveHost: true},
+			forwarded: &proxied,
+			expected:  `cloud.example.com|||||for="[2001:db8::1]";host=cloud.example.com;proto=https`,
+		},
+		{
+			name:     "none",
+			route:    config.Route{Forwarded: config.ForwardedNone},
+			expected: "example.com|||||",
+		},
+		{
+			name: "none with a header rule",
+			route: config.Route{Forwarded: config.ForwardedNone, RequestHeaders: []config.HeaderRule{
+				{Action: config.HeaderSet, Name: "X-Forwarded-For", Value: "198.51.100.7"},
+			}},
+			expected: "example.com|198.51.100.7||||",
+		},
+	}
+
+	for _, tt := range tests {
+		tt.route.Endpoint, tt.route.Backend = "/", backend.URL
+		cfg := testConfig([]config.Policy{{Name: "reva", Routes: []config.Route{tt.route}}})
+		p := NewMultiHostReverseProxy(Config(cfg))
+
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.Header.Set("X-Forwarded-For", "10.0.0.1")
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "evil.example.org")
+		r.Header.Set("Forwarded", "for=10.0.0.1")
+		if tt.forwarded != nil {
+			r = r.WithContext(request.NewForwardedContext(r.Context(), *tt.forwarded))
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if got := w.Body.String(); got != tt.expected {
+			t.Errorf("%s: expected %q got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestHeaderRules(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Set("X-Backend-Version", "10.5")
+		fmt.Fprintf(w, "%s|%s|%s|%s", r.Header.Get("X-User-Id"), r.Header.Get("X-Path"), r.Header.Get("X-Old"), r.Header.Get("X-New"))
+	}))
+	defer backend.Close()
+
+	cfg := testConfig([]config.Policy{
+		{Name: "reva", Routes: []config.Route{{
+			Endpoint: "/",
+			Backend:  backend.URL,
+			RequestHeaders: []config.HeaderRule{
+				{Action: config.HeaderSet, Name: "X-User-Id", Value: "{{.claims.preferred_username}}"},
+				{Action: config.HeaderAdd, Name: "X-Path", Value: "{{.method}} {{.path}}"},
+				{Action: config.HeaderRename, Name: "X-Old", Value: "X-New"},
+			},
+			ResponseHeaders: []config.HeaderRule{
+				{Action: config.HeaderRemove, Name: "X-Internal"},
+				{Action: config.HeaderRename, Name: "X-Backend-Version", Value: "X-Version"},
+				{Action: config.HeaderSet, Name: "Content-Security-Policy", Value: "default-src 'self'"},
+			},
+		}}},
+	})
+	p := NewMultiHostReverseProxy(Config(cfg))
+
+	tests := []struct {
+		name     string
+		claims   *oidc.StandardClaims
+		expected string
+	}{
+		{name: "authenticated", claims: &oidc.StandardClaims{PreferredUsername: "einstein"}, expected: "einstein|GET /files||value"},
+		{name: "spoofed user id", expected: "|GET /files||value"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/files", nil)
+		r.Header.Set("X-User-Id", "admin")
+		r.Header.Set("X-Old", "value")
+		if tt.claims != nil {
+			r = r.WithContext(oidc.NewContext(r.Context(), tt.claims))
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if got := w.Body.String(); got != tt.expected {
+			t.Errorf("%s: expected %q got %q", tt.name, tt.expected, got)
+		}
+		if got := w.Header().Get("X-Internal"); got != "" {
+			t.Errorf("%s: expected X-Internal to be removed got %q", tt.name, got)
+		}
+		if got := w.Header().Get("X-Version"); got != "10.5" {
+			t.Errorf("%s: expected X-Version 10.5 got %q", tt.name, got)
+		}
+		if got := w.Header().Get("Content-Security-Policy"); got != "default-src 'self'" {
+			t.Errorf("%s: expected a Content-Security-Policy got %q", tt.name, got)
+		}
+	}
+}
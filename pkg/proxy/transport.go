@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+// transport sends the requests to the backends. http backends which are configured for HTTP/2 are sent the requests
+// with h2c, all other backends use http.DefaultTransport, which negotiates HTTP/2 with https backends.
+type transport struct {
+	h2cHosts map[string]bool
+	h2c      http.RoundTripper
+	fallback http.RoundTripper
+}
+
+func newTransport() *transport {
+	return &transport{
+		h2cHosts: map[string]bool{},
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+		fallback: http.DefaultTransport,
+	}
+}
+
+// addH2CHost sends the requests to the http backend with the host with h2c.
+func (t *transport) addH2CHost(host string) {
+	t.h2cHosts[host] = true
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if xff := xForwardedForFromContext(r.Context()); xff != nil && xff.omit {
+		// undo the X-Forwarded-For header added by the reverse proxy
+		r = r.Clone(r.Context())
+		if xff.values == nil {
+			r.Header.Del("X-Forwarded-For")
+		} else {
+			r.Header["X-Forwarded-For"] = xff.values
+		}
+	}
+
+	if r.URL.Scheme == "http" && t.h2cHosts[r.URL.Host] {
+		return t.h2c.RoundTrip(r)
+	}
+	return t.fallback.RoundTrip(r)
+}
@@ -0,0 +1,187 @@
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+var htmlTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Code}} {{.Status}}</title></head>
+<body>
+<h1>{{.Code}} {{.Status}}</h1>
+<p>{{.Message}}</p>
+<p><small>Request ID: {{.RequestID}}</small></p>
+</body>
+</html>
+`))
+
+type errorBody struct {
+	Code      int    `json:"code"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+type ocsMeta struct {
+	Status     string `json:"status" xml:"status"`
+	StatusCode int    `json:"statuscode" xml:"statuscode"`
+	Message    string `json:"message" xml:"message"`
+	RequestID  string `json:"request_id" xml:"request_id"`
+}
+
+type ocsResponse struct {
+	XMLName xml.Name `json:"-" xml:"ocs"`
+	Meta    ocsMeta  `json:"meta" xml:"meta"`
+	Data    struct{} `json:"data" xml:"data"`
+}
+
+type davError struct {
+	XMLName   xml.Name `xml:"d:error"`
+	XmlnsD    string   `xml:"xmlns:d,attr"`
+	XmlnsS    string   `xml:"xmlns:s,attr"`
+	Exception string   `xml:"s:exception"`
+	Message   string   `xml:"s:message"`
+	RequestID string   `xml:"s:request-id"`
+}
+
+// Error writes an error response with the given status code. The format of the body depends on the request:
+// requests to the OCS API get an OCS envelope (XML or JSON), WebDAV requests get a <d:error> document and
+// everything else gets an HTML page, unless the client prefers JSON.
+func Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	id := requestID(w, r)
+	w.Header().Set(request.IDHeader, id)
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch {
+	case isOCS(r):
+		ocsError(w, r, status, message, id)
+	case isDAV(r):
+		webDAVError(w, status, message, id)
+	case acceptsJSON(r):
+		jsonError(w, status, message, id)
+	default:
+		htmlError(w, status, message, id)
+	}
+}
+
+func ocsError(w http.ResponseWriter, r *http.Request, status int, message, id string) {
+	res := ocsResponse{
+		Meta: ocsMeta{
+			Status:     "error",
+			StatusCode: ocsStatusCode(r, status),
+			Message:    message,
+			RequestID:  id,
+		},
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]ocsResponse{"ocs": res})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(res)
+}
+
+// ocsStatusCode maps http status codes to OCS status codes. OCS v2 uses the http status codes, OCS v1 uses its
+// own set of codes.
+func ocsStatusCode(r *http.Request, status int) int {
+	if !strings.Contains(r.URL.Path, "/v1.php/") {
+		return status
+	}
+
+	if status == http.StatusNotFound {
+		return 998
+	}
+
+	return 996
+}
+
+func webDAVError(w http.ResponseWriter, status int, message, id string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(davError{
+		XmlnsD:    "DAV:",
+		XmlnsS:    "http://sabredav.org/ns",
+		Exception: davException(status),
+		Message:   message,
+		RequestID: id,
+	})
+}
+
+func davException(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "Sabre\\DAV\\Exception\\NotFound"
+	case http.StatusServiceUnavailable:
+		return "Sabre\\DAV\\Exception\\ServiceUnavailable"
+	default:
+		return "Sabre\\DAV\\Exception"
+	}
+}
+
+func jsonError(w http.ResponseWriter, status int, message, id string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]errorBody{"error": newErrorBody(status, message, id)})
+}
+
+func htmlError(w http.ResponseWriter, status int, message, id string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = htmlTemplate.Execute(w, newErrorBody(status, message, id))
+}
+
+func newErrorBody(status int, message, id string) errorBody {
+	return errorBody{
+		Code:      status,
+		Status:    http.StatusText(status),
+		Message:   message,
+		RequestID: id,
+	}
+}
+
+func isOCS(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/ocs/")
+}
+
+func isDAV(r *http.Request) bool {
+	for _, prefix := range []string{"/remote.php/", "/dav/", "/webdav/"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// requestID returns the id of the request. If the request does not carry one a new id is generated.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := request.IDFromContext(r.Context()); id != "" {
+		return id
+	}
+
+	if id := w.Header().Get(request.IDHeader); id != "" {
+		return id
+	}
+
+	if id := r.Header.Get(request.IDHeader); request.ValidID(id) {
+		return id
+	}
+
+	return request.NewID()
+}
@@ -0,0 +1,64 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/owncloud/ocis-proxy/pkg/request"
+)
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		url         string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"https://example.com/ocs/v2.php/cloud/user", "", "text/xml", "<statuscode>404</statuscode>"},
+		{"https://example.com/ocs/v1.php/cloud/user", "", "text/xml", "<statuscode>998</statuscode>"},
+		{"https://example.com/ocs/v2.php/cloud/user?format=json", "", "application/json", `"statuscode":404`},
+		{"https://example.com/remote.php/webdav/file.txt", "", "application/xml", `<s:exception>Sabre\DAV\Exception\NotFound</s:exception>`},
+		{"https://example.com/dav/files/einstein", "", "application/xml", `<d:error xmlns:d="DAV:"`},
+		{"https://example.com/index.html", "application/json", "application/json", `"code":404`},
+		{"https://example.com/index.html", "text/html", "text/html", "<h1>404 Not Found</h1>"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		r.Header.Set("Accept", tt.accept)
+		r.Header.Set(request.IDHeader, "some-request-id")
+		w := httptest.NewRecorder()
+
+		Error(w, r, http.StatusNotFound, "not found")
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("with %s expected status %d got %d", tt.url, http.StatusNotFound, w.Code)
+		}
+
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+			t.Errorf("with %s expected content type %s got %s", tt.url, tt.contentType, got)
+		}
+
+		body := w.Body.String()
+		if !strings.Contains(body, tt.body) {
+			t.Errorf("with %s expected body to contain %s got %s", tt.url, tt.body, body)
+		}
+
+		if !strings.Contains(body, "some-request-id") {
+			t.Errorf("with %s expected body to contain the request id got %s", tt.url, body)
+		}
+	}
+}
+
+func TestErrorGeneratesRequestID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	w := httptest.NewRecorder()
+
+	Error(w, r, http.StatusBadGateway, "bad gateway")
+
+	if w.Header().Get(request.IDHeader) == "" {
+		t.Errorf("expected a generated request id")
+	}
+}
@@ -0,0 +1,216 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Forwarded describes the client side of a request. Behind trusted proxies it is taken from the Forwarded (RFC 7239)
+// or the X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers, otherwise from the connection.
+type Forwarded struct {
+	// For is the IP address of the client
+	For string
+	// Proto is the scheme the client used, http or https
+	Proto string
+	// Host is the host the client requested, including the port if there is one
+	Host string
+	// Proxied is true if the values were taken from the headers of a trusted proxy
+	Proxied bool
+}
+
+// TrustedProxies are the networks of the proxies whose forwarding headers are honoured.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses CIDRs and IP addresses.
+func ParseTrustedProxies(cidrs []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", c)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", c)
+		}
+		proxies = append(proxies, n)
+	}
+	return proxies, nil
+}
+
+// Contains reports whether the IP address belongs to a trusted proxy.
+func (t TrustedProxies) Contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client side of the request. The forwarding headers are only used if the request comes from a
+// trusted proxy. Proxies in front of it are skipped as long as they are trusted, too. The Forwarded header takes
+// precedence over the X-Forwarded-* headers.
+func (t TrustedProxies) Resolve(r *http.Request) Forwarded {
+	f := Forwarded{
+		For:   remoteIP(r.RemoteAddr),
+		Proto: "http",
+		Host:  r.Host,
+	}
+	if r.TLS != nil {
+		f.Proto = "https"
+	}
+
+	if !t.Contains(f.For) {
+		return f
+	}
+
+	hops := forwardedHops(r.Header)
+	if len(hops) == 0 {
+		hops = xForwardedHops(r.Header)
+	}
+	if len(hops) == 0 {
+		// some proxies only send X-Forwarded-Proto and X-Forwarded-Host
+		proto, host := lastValue(r.Header.Get("X-Forwarded-Proto")), lastValue(r.Header.Get("X-Forwarded-Host"))
+		if proto != "" || host != "" {
+			hops = []Forwarded{{For: f.For, Proto: proto, Host: host}}
+		}
+	}
+
+	// walk from the proxy next to us towards the client
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := hops[i]
+		if h.For == "" {
+			break
+		}
+		f.For, f.Proxied = h.For, true
+		if h.Proto != "" {
+			f.Proto = strings.ToLower(h.Proto)
+		}
+		if h.Host != "" {
+			f.Host = h.Host
+		}
+		if !t.Contains(h.For) {
+			break
+		}
+	}
+	return f
+}
+
+type forwardedKey struct{}
+
+// NewForwardedContext returns a new context with the client side of the request.
+func NewForwardedContext(ctx context.Context, f Forwarded) context.Context {
+	return context.WithValue(ctx, forwardedKey{}, f)
+}
+
+// ForwardedFrom returns the client side of the request stored in its context. Without one no proxy is trusted.
+func ForwardedFrom(r *http.Request) Forwarded {
+	if f, ok := r.Context().Value(forwardedKey{}).(Forwarded); ok {
+		return f
+	}
+	return TrustedProxies(nil).Resolve(r)
+}
+
+// forwardedHops parses the Forwarded header, one hop per element.
+func forwardedHops(h http.Header) []Forwarded {
+	var hops []Forwarded
+	for _, v := range h["Forwarded"] {
+		for _, element := range splitQuoted(v, ',') {
+			var hop Forwarded
+			for _, pair := range splitQuoted(element, ';') {
+				kv := strings.SplitN(pair, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+				switch strings.ToLower(strings.TrimSpace(kv[0])) {
+				case "for":
+					hop.For = nodeIP(value)
+				case "proto":
+					hop.Proto = value
+				case "host":
+					hop.Host = value
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// xForwardedHops parses the X-Forwarded-* headers. Proto and host were set by the proxy connected to us, so they belong
+// to the last hop, the client of that proxy. Earlier hops can be sent by the client and must not override them.
+func xForwardedHops(h http.Header) []Forwarded {
+	var hops []Forwarded
+	for _, v := range h["X-Forwarded-For"] {
+		for _, ip := range strings.Split(v, ",") {
+			hops = append(hops, Forwarded{For: nodeIP(strings.TrimSpace(ip))})
+		}
+	}
+	if len(hops) > 0 {
+		hops[len(hops)-1].Proto = lastValue(h.Get("X-Forwarded-Proto"))
+		hops[len(hops)-1].Host = lastValue(h.Get("X-Forwarded-Host"))
+	}
+	return hops
+}
+
+// splitQuoted splits s at sep outside of quoted strings.
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// nodeIP returns the IP address of a node, which can have a port and IPv6 addresses in brackets. Obfuscated and
+// unknown nodes return "".
+func nodeIP(node string) string {
+	if ip := net.ParseIP(node); ip != nil {
+		return ip.String()
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	if ip := net.ParseIP(strings.Trim(node, "[]")); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// lastValue returns the value appended by the proxy next to us.
+func lastValue(v string) string {
+	values := strings.Split(v, ",")
+	return strings.TrimSpace(values[len(values)-1])
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for addr, expected := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+		"::1":         true,
+		"":            false,
+	} {
+		if got := proxies.Contains(addr); got != expected {
+			t.Errorf("Contains(%q) expected %v got %v", addr, expected, got)
+		}
+	}
+
+	for _, c := range []string{"10.0.0.0/33", "proxy.example.com"} {
+		if _, err := ParseTrustedProxies([]string{c}); err == nil {
+			t.Errorf("expected an error for %q", c)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	proxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name     string
+		remote   string
+		tls      bool
+		headers  map[string]string
+		expected Forwarded
+	}{
+		{
+			name:     "direct connection",
+			remote:   "203.0.113.1:1234",
+			expected: Forwarded{For: "203.0.113.1", Proto: "http", Host: "cloud.example.com"},
+		},
+		{
+			name:     "direct tls connection",
+			remote:   "203.0.113.1:1234",
+			tls:      true,
+			expected: Forwarded{For: "203.0.113.1", Proto: "https", Host: "cloud.example.com"},
+		},
+		{
+			name:     "untrusted client",
+			remote:   "203.0.113.1:1234",
+			headers:  map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https"},
+			expected: Forwarded{For: "203.0.113.1", Proto: "http", Host: "cloud.example.com"},
+		},
+		{
+			name:   "trusted proxy",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "198.51.100.1, 10.0.0.2",
+				"X-Forwarded-Proto": "HTTPS",
+				"X-Forwarded-Host":  "files.example.com",
+			},
+			expected: Forwarded{For: "198.51.100.1", Proto: "https", Host: "files.example.com", Proxied: true},
+		},
+		{
+			name:   "client sent its own X-Forwarded-For",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "1.2.3.4, 203.0.113.7",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "files.example.com",
+			},
+			expected: Forwarded{For: "203.0.113.7", Proto: "https", Host: "files.example.com", Proxied: true},
+		},
+		{
+			name:     "spoofed hop before an untrusted client",
+			remote:   "10.0.0.1:1234",
+			headers:  map[string]string{"X-Forwarded-For": "10.0.0.3, 198.51.100.1"},
+			expected: Forwarded{For: "198.51.100.1", Proto: "http", Host: "cloud.example.com", Proxied: true},
+		},
+		{
+			name:     "only proto",
+			remote:   "10.0.0.1:1234",
+			headers:  map[string]string{"X-Forwarded-Proto": "http"},
+			expected: Forwarded{For: "10.0.0.1", Proto: "http", Host: "cloud.example.com", Proxied: true},
+		},
+		{
+			name:   "forwarded header takes precedence",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8::1]:4711";proto=https;host="files.example.com", for=10.0.0.2`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			expected: Forwarded{For: "2001:db8::1", Proto: "https", Host: "files.example.com", Proxied: true},
+		},
+		{
+			name:     "obfuscated node",
+			remote:   "10.0.0.1:1234",
+			headers:  map[string]string{"Forwarded": "for=_hidden, for=10.0.0.2;proto=https"},
+			expected: Forwarded{For: "10.0.0.2", Proto: "https", Host: "cloud.example.com", Proxied: true},
+		},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://cloud.example.com/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+
+		if got := proxies.Resolve(r); got != tt.expected {
+			t.Errorf("%s: expected %+v got %+v", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package request
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/owncloud/ocis-pkg/v2/log"
+)
+
+// IDHeader is the header used to propagate the request id.
+const IDHeader = "X-Request-ID"
+
+// maxIDLength limits the length of request ids accepted from clients.
+const maxIDLength = 128
+
+type idKey struct{}
+
+// NewIDContext returns a new context with the request id.
+func NewIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// IDFromContext returns the request id stored in ctx or an empty string.
+func IDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(idKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// NewID generates a new random request id.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidID reports whether id can be used as a request id. Ids sent by clients end up in logs and headers, so only
+// a limited set of characters is accepted.
+func ValidID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Logger returns a logger which adds the request id stored in ctx to every log entry.
+func Logger(ctx context.Context, l log.Logger) log.Logger {
+	id := IDFromContext(ctx)
+	if id == "" {
+		return l
+	}
+
+	return log.Logger{Logger: l.With().Str("request_id", id).Logger()}
+}
@@ -0,0 +1,49 @@
+package request
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestIDContext(t *testing.T) {
+	if id := IDFromContext(context.Background()); id != "" {
+		t.Errorf("expected an empty request id got %s", id)
+	}
+
+	ctx := NewIDContext(context.Background(), "some-id")
+	if id := IDFromContext(ctx); id != "some-id" {
+		t.Errorf("expected request id some-id got %s", id)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected bool
+	}{
+		{"", false},
+		{"b4ee3e1c-3b8e-4b53-8b10-bb3c4a7e6e0b", true},
+		{"abc.DEF_123:456", true},
+		{"with space", false},
+		{"with\nnewline", false},
+		{strings.Repeat("a", maxIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidID(tt.id); got != tt.expected {
+			t.Errorf("with %q expected %t got %t", tt.id, tt.expected, got)
+		}
+	}
+}
+
+func TestNewID(t *testing.T) {
+	id := NewID()
+	if !ValidID(id) {
+		t.Errorf("expected a valid request id got %q", id)
+	}
+
+	if id == NewID() {
+		t.Errorf("expected request ids to be unique")
+	}
+}
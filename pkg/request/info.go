@@ -0,0 +1,41 @@
+package request
+
+import "context"
+
+// Info collects what the proxy learned about a request while handling it. It is created by the outermost middleware
+// and filled in by the later stages, e.g. the selected policy by the proxy and the user by the auth middlewares.
+type Info struct {
+	// Policy is the name of the selected policy
+	Policy string
+	// RouteType is the type of the matched route
+	RouteType string
+	// Endpoint is the endpoint of the matched route
+	Endpoint string
+	// Backend is the backend the request was proxied to
+	Backend string
+	// UserID is the account id of the authenticated user
+	UserID string
+}
+
+type infoKey struct{}
+
+// NewInfoContext returns a new context with the request info.
+func NewInfoContext(ctx context.Context, info *Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// InfoFromContext returns the request info stored in ctx or nil.
+func InfoFromContext(ctx context.Context) *Info {
+	info, _ := ctx.Value(infoKey{}).(*Info)
+	return info
+}
+
+// EnsureInfo returns the request info stored in ctx. If there is none, a new one is added to the returned context.
+func EnsureInfo(ctx context.Context) (context.Context, *Info) {
+	if info := InfoFromContext(ctx); info != nil {
+		return ctx, info
+	}
+
+	info := &Info{}
+	return NewInfoContext(ctx, info), info
+}
@@ -12,9 +12,10 @@ type Option func(o *Options)
 
 // Options defines the available options for this package.
 type Options struct {
-	Logger  log.Logger
-	Context context.Context
-	Config  *config.Config
+	Logger     log.Logger
+	Context    context.Context
+	Config     *config.Config
+	ConfigDump interface{}
 }
 
 // newOptions initializes the available default options.
@@ -48,3 +49,10 @@ func Config(val *config.Config) Option {
 		o.Config = val
 	}
 }
+
+// ConfigDump provides a function to set the config dump option, served on /config.
+func ConfigDump(val interface{}) Option {
+	return func(o *Options) {
+		o.ConfigDump = val
+	}
+}
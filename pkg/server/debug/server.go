@@ -1,21 +1,28 @@
 package debug
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 
+	"github.com/justinas/alice"
+	"github.com/owncloud/ocis-pkg/v2/log"
+	"github.com/owncloud/ocis-pkg/v2/middleware"
 	"github.com/owncloud/ocis-pkg/v2/service/debug"
 	"github.com/owncloud/ocis-proxy/pkg/config"
 	"github.com/owncloud/ocis-proxy/pkg/version"
 )
 
+// name of the debug service, sent in the version headers
+const name = "proxy"
+
 // Server initializes the debug service and server.
 func Server(opts ...Option) (*http.Server, error) {
 	options := newOptions(opts...)
 
-	return debug.NewService(
+	server := debug.NewService(
 		debug.Logger(options.Logger),
-		debug.Name("proxy"),
+		debug.Name(name),
 		debug.Version(version.String),
 		debug.Address(options.Config.Debug.Addr),
 		debug.Token(options.Config.Debug.Token),
@@ -23,7 +30,30 @@ func Server(opts ...Option) (*http.Server, error) {
 		debug.Zpages(options.Config.Debug.Zpages),
 		debug.Health(health(options.Config)),
 		debug.Ready(ready(options.Config)),
-	), nil
+	)
+
+	if options.ConfigDump != nil {
+		// the configuration reveals the internal setup, it is only served with a token
+		if options.Config.Debug.Token == "" {
+			options.Logger.Info().Msg("No debug token configured, not serving the configuration at /config")
+		} else {
+			// the debug service does not expose its mux, so the handler gets the same middlewares as its handlers
+			mux := http.NewServeMux()
+			mux.Handle("/config", alice.New(
+				middleware.RealIP,
+				middleware.RequestID,
+				middleware.Cache,
+				middleware.Cors,
+				middleware.Secure,
+				middleware.Version(name, version.String),
+				middleware.Token(options.Config.Debug.Token),
+			).Then(configDump(options.Logger, options.ConfigDump)))
+			mux.Handle("/", server.Handler)
+			server.Handler = mux
+		}
+	}
+
+	return server, nil
 }
 
 // health implements the health check.
@@ -38,6 +68,20 @@ func health(cfg *config.Config) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+// configDump serves the effective configuration.
+func configDump(l log.Logger, dump interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dump); err != nil {
+			l.Error().Err(err).Msg("Failed to encode the configuration")
+		}
+	})
+}
+
 // ready implements the ready check.
 func ready(cfg *config.Config) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
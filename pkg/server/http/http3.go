@@ -0,0 +1,56 @@
+//go:build http3
+// +build http3
+
+package http
+
+import (
+	"net/http"
+
+	"github.com/lucas-clemente/quic-go/http3"
+)
+
+// HTTP3Supported is true if the proxy was built with the http3 build tag.
+const HTTP3Supported = true
+
+// HTTP3Server serves HTTP/3 (QUIC) on the UDP port of the address of the http server.
+type HTTP3Server struct {
+	server *http3.Server
+}
+
+// HTTP3 initializes the HTTP/3 server. It uses the same middlewares and TLS configuration as Server.
+func HTTP3(opts ...Option) (*HTTP3Server, error) {
+	options := newOptions(opts...)
+
+	return &HTTP3Server{
+		server: &http3.Server{
+			Server: &http.Server{
+				Addr:      options.Config.HTTP.Addr,
+				Handler:   handler(options, false),
+				TLSConfig: tlsConfig(options),
+			},
+		},
+	}, nil
+}
+
+// Addr is the UDP address the server listens on.
+func (s *HTTP3Server) Addr() string {
+	return s.server.Addr
+}
+
+// ListenAndServe listens on the UDP address and serves the requests.
+func (s *HTTP3Server) ListenAndServe() error {
+	return s.server.ListenAndServe()
+}
+
+// Close stops the server.
+func (s *HTTP3Server) Close() error {
+	return s.server.Close()
+}
+
+// AltSvc is a middleware which advertises HTTP/3 on the responses with an Alt-Svc header.
+func (s *HTTP3Server) AltSvc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = s.server.SetQuicHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
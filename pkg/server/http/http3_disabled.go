@@ -0,0 +1,42 @@
+//go:build !http3
+// +build !http3
+
+package http
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTP3Supported is true if the proxy was built with the http3 build tag.
+const HTTP3Supported = false
+
+var errHTTP3NotSupported = errors.New("the proxy was built without HTTP/3 support, build it with -tags http3")
+
+// HTTP3Server serves HTTP/3 (QUIC) on the UDP port of the address of the http server.
+type HTTP3Server struct{}
+
+// HTTP3 initializes the HTTP/3 server. Without the http3 build tag it always fails.
+func HTTP3(opts ...Option) (*HTTP3Server, error) {
+	return nil, errHTTP3NotSupported
+}
+
+// Addr is the UDP address the server listens on.
+func (s *HTTP3Server) Addr() string {
+	return ""
+}
+
+// ListenAndServe listens on the UDP address and serves the requests.
+func (s *HTTP3Server) ListenAndServe() error {
+	return errHTTP3NotSupported
+}
+
+// Close stops the server.
+func (s *HTTP3Server) Close() error {
+	return nil
+}
+
+// AltSvc is a middleware which advertises HTTP/3 on the responses with an Alt-Svc header.
+func (s *HTTP3Server) AltSvc(next http.Handler) http.Handler {
+	return next
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ListenerServer serves an additional listener.
+type ListenerServer struct {
+	*http.Server
+	network string
+	addr    string
+}
+
+// Listener initializes the server of an additional listener. Unlike Server it is not registered as a service.
+func Listener(opts ...Option) (*ListenerServer, error) {
+	options := newOptions(opts...)
+	lc := options.Listener
+
+	var tlsConf *tls.Config
+	if lc.TLS {
+		tlsConf = tlsConfig(options)
+	}
+
+	s := &ListenerServer{
+		Server: &http.Server{
+			Addr:      lc.Addr,
+			Handler:   handler(options, tlsConf == nil && lc.H2C),
+			TLSConfig: tlsConf,
+		},
+		network: "tcp",
+		addr:    lc.Addr,
+	}
+	if strings.HasPrefix(lc.Addr, "unix:") {
+		s.network, s.addr = "unix", strings.TrimPrefix(lc.Addr, "unix:")
+	}
+
+	return s, nil
+}
+
+// ListenAndServe listens on the address and serves the requests. An existing unix socket is replaced, other files
+// are never removed.
+func (s *ListenerServer) ListenAndServe() error {
+	if s.network == "unix" {
+		if err := removeSocket(s.addr); err != nil {
+			return err
+		}
+	}
+
+	l, err := net.Listen(s.network, s.addr)
+	if err != nil {
+		return err
+	}
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+
+	return s.Serve(l)
+}
+
+// removeSocket removes a stale unix socket, e.g. of a previous run.
+func removeSocket(path string) error {
+	fi, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case fi.Mode()&os.ModeSocket == 0:
+		return fmt.Errorf("%s exists and is not a unix socket", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "proxy.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep the socket file when closing the listener, like a crashed process
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	if err := removeSocket(socket); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(socket); !os.IsNotExist(err) {
+		t.Error("Expected the socket to be removed")
+	}
+	if err := removeSocket(socket); err != nil {
+		t.Errorf("Unexpected error for a missing socket: %v", err)
+	}
+
+	file := filepath.Join(dir, "proxy.yml")
+	if err := ioutil.WriteFile(file, []byte("policies: []"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeSocket(file); err == nil {
+		t.Error("Expected an error for a regular file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Expected the file to be kept: %v", err)
+	}
+}
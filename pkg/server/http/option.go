@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 
 	"github.com/justinas/alice"
@@ -9,6 +10,7 @@ import (
 	"github.com/owncloud/ocis-pkg/v2/log"
 	"github.com/owncloud/ocis-proxy/pkg/config"
 	"github.com/owncloud/ocis-proxy/pkg/metrics"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // Option defines a single option function.
@@ -24,6 +26,9 @@ type Options struct {
 	Flags       []cli.Flag
 	Namespace   string
 	Middlewares alice.Chain
+	ACMEManager *autocert.Manager
+	Listener    config.Listener
+	TLSConfig   *tls.Config
 }
 
 // newOptions initializes the available default options.
@@ -92,3 +97,24 @@ func Middlewares(val alice.Chain) Option {
 		o.Middlewares = val
 	}
 }
+
+// ACMEManager provides a function to obtain the TLS certificates from an ACME certificate authority
+func ACMEManager(val *autocert.Manager) Option {
+	return func(o *Options) {
+		o.ACMEManager = val
+	}
+}
+
+// ListenerConfig provides a function to set the configuration of an additional listener
+func ListenerConfig(val config.Listener) Option {
+	return func(o *Options) {
+		o.Listener = val
+	}
+}
+
+// TLSConfig provides a function to share the TLS configuration of LoadTLSConfig between the listeners
+func TLSConfig(val *tls.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = val
+	}
+}
@@ -2,10 +2,8 @@ package http
 
 import (
 	"crypto/tls"
-	"os"
 
 	svc "github.com/owncloud/ocis-pkg/v2/service/http"
-	"github.com/owncloud/ocis-proxy/pkg/crypto"
 	"github.com/owncloud/ocis-proxy/pkg/version"
 )
 
@@ -15,41 +13,16 @@ func Server(opts ...Option) (svc.Service, error) {
 	l := options.Logger
 	httpCfg := options.Config.HTTP
 
-	var cer tls.Certificate
-	var certErr error
-
-	var tlsConfig *tls.Config
-	if options.Config.HTTP.TLS {
-		if httpCfg.TLSCert == "" || httpCfg.TLSKey == "" {
-			l.Warn().Msgf("No tls certificate provided, using a generated one")
-			_, certErr := os.Stat("./server.crt")
-			_, keyErr := os.Stat("./server.key")
-
-			if os.IsNotExist(certErr) || os.IsNotExist(keyErr) {
-				// GenCert has side effects as it writes 2 files to the binary running location
-				if err := crypto.GenCert(l); err != nil {
-					l.Fatal().Err(err).Msgf("Could not generate test-certificate")
-					os.Exit(1)
-				}
-			}
-
-			httpCfg.TLSCert = "server.crt"
-			httpCfg.TLSKey = "server.key"
-		}
-
-		cer, certErr = tls.LoadX509KeyPair(httpCfg.TLSCert, httpCfg.TLSKey)
-		if certErr != nil {
-			options.Logger.Fatal().Err(certErr).Msg("Could not setup TLS")
-			os.Exit(1)
-		}
-
-		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cer}}
+	var tlsConf *tls.Config
+	if httpCfg.TLS {
+		tlsConf = tlsConfig(options)
 	}
-	chain := options.Middlewares.Then(options.Handler)
+
+	chain := handler(options, tlsConf == nil && httpCfg.H2C)
 
 	service := svc.NewService(
 		svc.Name("web.proxy"),
-		svc.TLSConfig(tlsConfig),
+		svc.TLSConfig(tlsConf),
 		svc.Logger(options.Logger),
 		svc.Namespace(options.Namespace),
 		svc.Version(version.String),
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/owncloud/ocis-proxy/pkg/crypto"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// LoadTLSConfig returns the TLS configuration of the listeners. The certificates come from the ACME manager, the
+// configured files or a generated self signed certificate. Load it once and share it between the listeners with the
+// TLSConfig option, every call starts watching the certificate files.
+func LoadTLSConfig(opts ...Option) *tls.Config {
+	return loadTLSConfig(newOptions(opts...))
+}
+
+// tlsConfig returns the shared TLS configuration or loads it.
+func tlsConfig(options Options) *tls.Config {
+	if options.TLSConfig != nil {
+		return options.TLSConfig
+	}
+	return loadTLSConfig(options)
+}
+
+func loadTLSConfig(options Options) *tls.Config {
+	l := options.Logger
+	httpCfg := options.Config.HTTP
+
+	var tlsConfig *tls.Config
+	if options.ACMEManager != nil {
+		l.Info().Strs("domains", httpCfg.ACME.Domains).Msg("Using certificates from ACME")
+		tlsConfig = options.ACMEManager.TLSConfig()
+	} else {
+		if (httpCfg.TLSCert == "" || httpCfg.TLSKey == "") && httpCfg.TLSCertDir == "" {
+			l.Warn().Msgf("No tls certificate provided, using a generated one")
+			_, certErr := os.Stat("./server.crt")
+			_, keyErr := os.Stat("./server.key")
+
+			if os.IsNotExist(certErr) || os.IsNotExist(keyErr) {
+				// GenCert has side effects as it writes 2 files to the binary running location
+				if err := crypto.GenCert(l, crypto.Hosts(certHosts(httpCfg.Addr)...)); err != nil {
+					l.Fatal().Err(err).Msgf("Could not generate test-certificate")
+					os.Exit(1)
+				}
+			}
+
+			httpCfg.TLSCert = "server.crt"
+			httpCfg.TLSKey = "server.key"
+		}
+
+		store, err := crypto.NewCertStore(l, httpCfg.TLSCert, httpCfg.TLSKey, httpCfg.TLSCertDir)
+		if err != nil {
+			options.Logger.Fatal().Err(err).Msg("Could not setup TLS")
+			os.Exit(1)
+		}
+
+		if httpCfg.TLSReloadInterval > 0 {
+			ctx := options.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			go store.Watch(ctx, httpCfg.TLSReloadInterval)
+		}
+
+		tlsConfig = &tls.Config{GetCertificate: store.GetCertificate}
+	}
+
+	var err error
+	if tlsConfig.MinVersion, err = crypto.TLSVersion(httpCfg.TLSMinVersion); err != nil {
+		options.Logger.Fatal().Err(err).Msg("Could not setup TLS")
+		os.Exit(1)
+	}
+	if tlsConfig.CipherSuites, err = crypto.CipherSuites(httpCfg.TLSCipherSuites); err != nil {
+		options.Logger.Fatal().Err(err).Msg("Could not setup TLS")
+		os.Exit(1)
+	}
+
+	if options.Config.ClientCertAuth.Enabled {
+		pem, err := ioutil.ReadFile(options.Config.ClientCertAuth.CA)
+		if err != nil {
+			options.Logger.Fatal().Err(err).Msg("Could not read the client certificate CA")
+			os.Exit(1)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			options.Logger.Fatal().Str("file", options.Config.ClientCertAuth.CA).Msg("No client certificate CA found")
+			os.Exit(1)
+		}
+		// whether a certificate is required depends on the path, which is checked by the ClientCertAuth middleware
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	tlsConfig.NextProtos = nextProtos(tlsConfig.NextProtos, httpCfg.HTTP2)
+	return tlsConfig
+}
+
+// handler returns the handler wrapped in the middlewares, optionally serving h2c.
+func handler(options Options, withH2C bool) http.Handler {
+	chain := options.Middlewares.Then(options.Handler)
+	if withH2C {
+		options.Logger.Info().Msg("Serving HTTP/2 without TLS (h2c)")
+		chain = h2c.NewHandler(chain, &http2.Server{})
+	}
+	return chain
+}
+
+// certHosts returns the hosts of the generated certificate, localhost and the host the proxy listens on.
+func certHosts(addr string) []string {
+	hosts := []string{"127.0.0.1", "localhost"}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || host == "localhost" || host == "127.0.0.1" {
+		return hosts
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return hosts
+	}
+	return append(hosts, host)
+}
+
+// nextProtos returns the ALPN protocols offered on TLS connections with or without HTTP/2. Other protocols, like the
+// one of ACME TLS-ALPN-01 challenges, are kept.
+func nextProtos(protos []string, http2 bool) []string {
+	result := make([]string, 0, len(protos)+2)
+	if http2 {
+		result = append(result, "h2")
+	}
+	result = append(result, "http/1.1")
+	for _, p := range protos {
+		if p != "h2" && p != "http/1.1" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opencensus.io/plugin/ochttp/propagation/b3"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+	"go.opencensus.io/trace/propagation"
+)
+
+var (
+	// inbound formats in the order they are checked
+	inbound = []propagation.HTTPFormat{
+		&tracecontext.HTTPFormat{},
+		&b3.HTTPFormat{},
+	}
+
+	// outbound is used to pass the trace context to the backends
+	outbound propagation.HTTPFormat = &tracecontext.HTTPFormat{}
+)
+
+// StartServerSpan starts the span for an incoming request. A W3C trace context or B3 headers sent by the client are
+// continued, otherwise a new trace is started.
+func StartServerSpan(r *http.Request, name string) (context.Context, *trace.Span) {
+	for _, f := range inbound {
+		if sc, ok := f.SpanContextFromRequest(r); ok {
+			return trace.StartSpanWithRemoteParent(r.Context(), name, sc, trace.WithSpanKind(trace.SpanKindServer))
+		}
+	}
+
+	return trace.StartSpan(r.Context(), name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// Propagate adds the trace context of the span in ctx to the headers of an outgoing request.
+func Propagate(ctx context.Context, r *http.Request) {
+	if span := trace.FromContext(ctx); span != nil {
+		outbound.SpanContextToRequest(span.SpanContext(), r)
+	}
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestStartServerSpan(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		traceID string
+	}{
+		{
+			"w3c",
+			map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+			"0af7651916cd43dd8448eb211c80319c",
+		},
+		{
+			"b3",
+			map[string]string{"X-B3-TraceId": "463ac35c9f6413ad48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-Sampled": "1"},
+			"463ac35c9f6413ad48485a3953bb6124",
+		},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+
+		_, span := StartServerSpan(r, "test")
+		span.End()
+
+		if got := span.SpanContext().TraceID.String(); got != tt.traceID {
+			t.Errorf("with %s expected trace id %s got %s", tt.name, tt.traceID, got)
+		}
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	ctx, span := trace.StartSpan(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "test", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+
+	r := httptest.NewRequest(http.MethodGet, "http://backend/", nil)
+	Propagate(ctx, r)
+
+	if r.Header.Get("traceparent") == "" {
+		t.Errorf("expected a traceparent header")
+	}
+}